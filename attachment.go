@@ -0,0 +1,158 @@
+package couch
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+)
+
+// AttachmentStub describes an attachment listed in the _attachments of a
+// document fetched without attachment bodies. Encoding and EncodedLength are
+// only set for compressed attachments of documents requested with
+// att_encoding_info=true.
+type AttachmentStub struct {
+	ContentType   string `json:"content_type"`
+	Length        uint64 `json:"length"`
+	Stub          bool   `json:"stub"`
+	Digest        string `json:"digest"`
+	Revpos        int    `json:"revpos"`
+	Encoding      string `json:"encoding"`
+	EncodedLength uint64 `json:"encoded_length"`
+}
+
+// AttachmentStubs parses the _attachments of doc, keyed by attachment name.
+// Returns an empty map if doc has no attachments.
+func AttachmentStubs(doc map[string]interface{}) (map[string]*AttachmentStub, error) {
+	stubs := make(map[string]*AttachmentStub)
+	atts, ok := doc["_attachments"]
+	if !ok {
+		return stubs, nil
+	}
+	b, err := json.Marshal(atts)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(b, &stubs); err != nil {
+		return nil, fmt.Errorf("invalid _attachments value: %v", err)
+	}
+	return stubs, nil
+}
+
+// AttachInline adds data as attachment name to the _attachments of doc, base64
+// encoded, so it's stored with the document by the next Insert or Update.
+// Existing entries, like the stubs of a fetched document, are kept, which is
+// required for updates to not remove the other attachments. Meant for small
+// attachments, PutAttachment streams larger ones.
+func AttachInline(doc map[string]interface{}, name, contentType string, data []byte) {
+	atts, ok := doc["_attachments"].(map[string]interface{})
+	if !ok {
+		atts = make(map[string]interface{})
+		doc["_attachments"] = atts
+	}
+	atts[name] = map[string]interface{}{
+		"content_type": contentType,
+		"data":         base64.StdEncoding.EncodeToString(data),
+	}
+}
+
+// GetAttachmentStubs fetches document id with att_encoding_info=true and
+// returns its attachment stubs, without the attachment bodies.
+func (c *Couch) GetAttachmentStubs(id Id) (map[string]*AttachmentStub, error) {
+	var doc map[string]interface{}
+	if err := c.get(id, url.Values{"att_encoding_info": []string{"true"}}, &doc); err != nil {
+		return nil, err
+	}
+	return AttachmentStubs(doc)
+}
+
+// Attachment is an attachment body returned by GetAttachment. Body must be
+// closed by the caller.
+type Attachment struct {
+	ContentType string
+	Length      int64 // -1 if unknown
+	Body        io.ReadCloser
+
+	// Encoding and EncodedLength describe how the attachment is stored on
+	// disk, e.g. "gzip" for compressible content types. They are only set if
+	// encoding info was requested and the attachment is compressed.
+	Encoding      string
+	EncodedLength uint64
+}
+
+// GetAttachment returns the attachment name of document id. The body is
+// streamed and returned decoded. If encodingInfo is true the document is
+// fetched with att_encoding_info=true first, which is useful to see how well
+// attachments compress on disk.
+func (c *Couch) GetAttachment(id Id, name string, encodingInfo bool) (*Attachment, error) {
+	var stub *AttachmentStub
+	if encodingInfo {
+		stubs, err := c.GetAttachmentStubs(id)
+		if err != nil {
+			return nil, err
+		}
+		stub = stubs[name]
+	}
+	u, err := c.docURL(id)
+	if err != nil {
+		return nil, err
+	}
+	resp, _, err := c.fetch("GET", u+"/"+escapeSegment(name), nil, true)
+	if err != nil {
+		return nil, err
+	}
+	att := &Attachment{
+		ContentType: resp.Header.Get("Content-Type"),
+		Length:      resp.ContentLength,
+		Body:        resp.Body,
+	}
+	if stub != nil {
+		att.Encoding = stub.Encoding
+		att.EncodedLength = stub.EncodedLength
+	}
+	return att, nil
+}
+
+// PutAttachment stores the attachment name of document id, reading size bytes
+// from r. The body is streamed, so large files don't need to be loaded into
+// memory. If size is negative the body is sent with chunked encoding. An empty
+// rev creates a new document holding only the attachment. Returns the new
+// revision of the document.
+func (c *Couch) PutAttachment(id Id, rev Rev, name, contentType string, r io.Reader, size int64) (Rev, error) {
+	return c.PutAttachmentEncoded(id, rev, name, contentType, "", r, size)
+}
+
+// PutAttachmentEncoded is like PutAttachment, but r holds the attachment
+// compressed with encoding, which CouchDB only supports as "gzip". The
+// attachment is stored as sent, without compressing it again, and served
+// compressed to clients accepting the encoding. size is the compressed size.
+// An empty encoding sends the body as is, like PutAttachment.
+func (c *Couch) PutAttachmentEncoded(id Id, rev Rev, name, contentType, encoding string, r io.Reader, size int64) (Rev, error) {
+	u, err := c.docURL(id)
+	if err != nil {
+		return "", err
+	}
+	u += "/" + escapeSegment(name)
+	if rev != "" {
+		u += "?rev=" + url.QueryEscape(string(rev))
+	}
+	var headers http.Header
+	if encoding != "" {
+		headers = http.Header{"Content-Encoding": []string{encoding}}
+	}
+	resp, err := c.reqBody(context.Background(), "PUT", u, contentType, headers, r, size, c.url.User)
+	if err != nil {
+		return "", err
+	}
+	var v insertResponse
+	if err := c.unmarshalInto(resp, 201, &v); err != nil {
+		return "", err
+	}
+	if v.Rev == "" {
+		return "", fmt.Errorf("rev not set")
+	}
+	return v.Rev, nil
+}
@@ -0,0 +1,200 @@
+package couch
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestPutAttachment(t *testing.T) {
+	couch := &Couch{}
+	if _, err := couch.PutAttachment("doc", "", "a.txt", "text/plain", strings.NewReader("x"), 1); err == nil {
+		t.Fatal("error nil")
+	}
+	couch, srv := newTestCouch(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "PUT" {
+			t.Error("invalid method", r.Method)
+		}
+		if r.URL.EscapedPath() != "/mydb/doc%201/my%20file.txt" {
+			t.Error("invalid path", r.URL.EscapedPath())
+		}
+		if r.URL.Query().Get("rev") != "1-abc" {
+			t.Error("invalid rev", r.URL.Query().Get("rev"))
+		}
+		if r.ContentLength != 11 || len(r.TransferEncoding) != 0 {
+			t.Error("body not sent with content length", r.ContentLength, r.TransferEncoding)
+		}
+		if r.Header.Get("Content-Type") != "text/plain" {
+			t.Error("invalid content type", r.Header.Get("Content-Type"))
+		}
+		b, _ := ioutil.ReadAll(r.Body)
+		if string(b) != "hello world" {
+			t.Error("invalid body", string(b))
+		}
+		w.WriteHeader(201)
+		w.Write([]byte("{\"ok\":true,\"id\":\"doc 1\",\"rev\":\"2-def\"}"))
+	})
+	defer srv.Close()
+	rev, err := couch.PutAttachment("doc 1", "1-abc", "my file.txt", "text/plain", strings.NewReader("hello world"), 11)
+	if err != nil {
+		t.Fatal("error not nil", err)
+	}
+	if rev != "2-def" {
+		t.Fatal("invalid rev", rev)
+	}
+}
+
+func TestPutAttachmentEncoded(t *testing.T) {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	zw.Write([]byte("body { color: red }"))
+	zw.Close()
+	gzipped := buf.Bytes()
+	couch, srv := newTestCouch(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/mydb/doc/style.css" || r.Header.Get("Content-Encoding") != "gzip" || r.Header.Get("Content-Type") != "text/css" {
+			t.Error("invalid request", r.URL.Path, r.Header)
+		}
+		b, _ := ioutil.ReadAll(r.Body)
+		if !bytes.Equal(b, gzipped) {
+			t.Error("body not sent as is")
+		}
+		w.WriteHeader(201)
+		w.Write([]byte("{\"ok\":true,\"id\":\"doc\",\"rev\":\"2-a\"}"))
+	})
+	defer srv.Close()
+	rev, err := couch.PutAttachmentEncoded("doc", "1-a", "style.css", "text/css", "gzip", bytes.NewReader(gzipped), int64(len(gzipped)))
+	if err != nil {
+		t.Fatal("error not nil", err)
+	}
+	if rev != "2-a" {
+		t.Fatal("invalid rev", rev)
+	}
+}
+
+func TestAttachmentStubs(t *testing.T) {
+	stubs, err := AttachmentStubs(map[string]interface{}{"_id": "doc"})
+	if err != nil {
+		t.Fatal("error not nil", err)
+	}
+	if len(stubs) != 0 {
+		t.Fatal("expected no stubs", stubs)
+	}
+	if _, err = AttachmentStubs(map[string]interface{}{"_attachments": "x"}); err == nil {
+		t.Fatal("error nil")
+	}
+	couch, srv := newTestCouch(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/mydb/doc" || r.URL.Query().Get("att_encoding_info") != "true" {
+			t.Error("invalid request", r.URL)
+		}
+		w.Write([]byte("{\"_id\":\"doc\",\"_rev\":\"2-abc\",\"_attachments\":{" +
+			"\"a.txt\":{\"content_type\":\"text/plain\",\"revpos\":2,\"digest\":\"md5-x\",\"length\":100," +
+			"\"stub\":true,\"encoding\":\"gzip\",\"encoded_length\":40}," +
+			"\"b.png\":{\"content_type\":\"image/png\",\"revpos\":1,\"digest\":\"md5-y\",\"length\":300,\"stub\":true}}}"))
+	})
+	defer srv.Close()
+	stubs, err = couch.GetAttachmentStubs("doc")
+	if err != nil {
+		t.Fatal("error not nil", err)
+	}
+	if len(stubs) != 2 {
+		t.Fatal("expected 2 stubs", stubs)
+	}
+	a := stubs["a.txt"]
+	if a == nil || a.ContentType != "text/plain" || a.Length != 100 || !a.Stub || a.Digest != "md5-x" ||
+		a.Revpos != 2 || a.Encoding != "gzip" || a.EncodedLength != 40 {
+		t.Fatal("invalid stub", a)
+	}
+	b := stubs["b.png"]
+	if b == nil || b.ContentType != "image/png" || b.Length != 300 || b.Encoding != "" {
+		t.Fatal("invalid stub", b)
+	}
+}
+
+func TestAttachInline(t *testing.T) {
+	couch, srv := newTestCouch(t, func(w http.ResponseWriter, r *http.Request) {
+		var v struct {
+			Attachments map[string]struct {
+				ContentType string `json:"content_type"`
+				Data        string `json:"data"`
+				Stub        bool   `json:"stub"`
+			} `json:"_attachments"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&v); err != nil {
+			t.Error("invalid body", err)
+		}
+		a, b := v.Attachments["a.txt"], v.Attachments["b.png"]
+		if a.ContentType != "text/plain" || a.Data != "aGVsbG8=" || !b.Stub {
+			t.Error("invalid attachments", v.Attachments)
+		}
+		w.WriteHeader(201)
+		w.Write([]byte("{\"ok\":true,\"id\":\"doc\",\"rev\":\"3-a\"}"))
+	})
+	defer srv.Close()
+	doc := map[string]interface{}{
+		"_attachments": map[string]interface{}{
+			"b.png": map[string]interface{}{"content_type": "image/png", "stub": true},
+		},
+	}
+	AttachInline(doc, "a.txt", "text/plain", []byte("hello"))
+	if _, _, err := couch.Insert(doc); err != nil {
+		t.Fatal("error not nil", err)
+	}
+	doc = map[string]interface{}{}
+	AttachInline(doc, "a.txt", "text/plain", nil)
+	if atts, ok := doc["_attachments"].(map[string]interface{}); !ok || len(atts) != 1 {
+		t.Fatal("invalid attachments", doc)
+	}
+}
+
+func TestGetAttachment(t *testing.T) {
+	var docRequests int
+	couch, srv := newTestCouch(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/mydb/doc":
+			docRequests++
+			if r.URL.Query().Get("att_encoding_info") != "true" {
+				t.Error("encoding info not requested", r.URL)
+			}
+			w.Write([]byte("{\"_id\":\"doc\",\"_rev\":\"1-a\",\"_attachments\":{\"a b.txt\":{\"content_type\":\"text/plain\"," +
+				"\"length\":11,\"stub\":true,\"encoding\":\"gzip\",\"encoded_length\":31}}}"))
+		case "/mydb/doc/a b.txt":
+			w.Header().Set("Content-Type", "text/plain")
+			w.Write([]byte("hello world"))
+		default:
+			w.WriteHeader(404)
+			w.Write([]byte("{\"error\":\"not_found\",\"reason\":\"Document is missing attachment\"}"))
+		}
+	})
+	defer srv.Close()
+	att, err := couch.GetAttachment("doc", "a b.txt", false)
+	if err != nil {
+		t.Fatal("error not nil", err)
+	}
+	b, err := ioutil.ReadAll(att.Body)
+	att.Body.Close()
+	if err != nil {
+		t.Fatal("error not nil", err)
+	}
+	if string(b) != "hello world" || att.ContentType != "text/plain" || att.Length != 11 || att.Encoding != "" {
+		t.Fatal("invalid attachment", att, string(b))
+	}
+	if docRequests != 0 {
+		t.Fatal("document fetched without encoding info")
+	}
+	att, err = couch.GetAttachment("doc", "a b.txt", true)
+	if err != nil {
+		t.Fatal("error not nil", err)
+	}
+	att.Body.Close()
+	if att.Encoding != "gzip" || att.EncodedLength != 31 || docRequests != 1 {
+		t.Fatal("invalid encoding info", att)
+	}
+	if _, err = couch.GetAttachment("doc", "missing.txt", false); !errors.Is(err, ErrNotFound) {
+		t.Fatal("expected not found", err)
+	}
+}
@@ -0,0 +1,180 @@
+package couch
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// SecurityGroup lists the users and roles of a section of a database's
+// security object.
+type SecurityGroup struct {
+	Names []string `json:"names"`
+	Roles []string `json:"roles"`
+}
+
+// has reports whether the user name or any of roles is in the group.
+func (g SecurityGroup) has(name string, roles []string) bool {
+	for _, n := range g.Names {
+		if n == name && name != "" {
+			return true
+		}
+	}
+	for _, r := range g.Roles {
+		for _, role := range roles {
+			if r == role {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (g SecurityGroup) empty() bool {
+	return len(g.Names) == 0 && len(g.Roles) == 0
+}
+
+// Security is the _security object of a database.
+type Security struct {
+	Admins  SecurityGroup `json:"admins"`
+	Members SecurityGroup `json:"members"`
+}
+
+// GetSecurity returns the security object of the database.
+func (c *Couch) GetSecurity() (*Security, error) {
+	u, err := c.dbURL("_security")
+	if err != nil {
+		return nil, err
+	}
+	sec := &Security{}
+	if err := c.getJSON(u, sec); err != nil {
+		return nil, err
+	}
+	return sec, nil
+}
+
+// Session describes the user the client is authenticated as.
+type Session struct {
+	Name  string   // Empty for anonymous users
+	Roles []string // Server admins have the _admin role
+}
+
+// SessionInfo returns the user of the client's credentials.
+func (c *Couch) SessionInfo() (*Session, error) {
+	var v struct {
+		UserCtx struct {
+			Name  string   `json:"name"`
+			Roles []string `json:"roles"`
+		} `json:"userCtx"`
+	}
+	if err := c.getJSON(c.BaseURL()+"/_session", &v); err != nil {
+		return nil, err
+	}
+	return &Session{Name: v.UserCtx.Name, Roles: v.UserCtx.Roles}, nil
+}
+
+// CanWrite reports whether the client's user may write documents to the
+// database, according to its session and the database's security object.
+// Server admins, database admins and members may write, and everyone may
+// write to databases without members. Reading the security object needs
+// member access, so being denied it means the user may not write either.
+// Validation functions of design documents can still reject individual
+// writes.
+func (c *Couch) CanWrite() (bool, error) {
+	session, err := c.SessionInfo()
+	if err != nil {
+		return false, err
+	}
+	sec, err := c.GetSecurity()
+	if errors.Is(err, ErrForbidden) || errors.Is(err, ErrUnauthorized) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	for _, role := range session.Roles {
+		if role == "_admin" {
+			return true, nil
+		}
+	}
+	if sec.Admins.has(session.Name, session.Roles) || sec.Members.empty() {
+		return true, nil
+	}
+	return sec.Members.has(session.Name, session.Roles), nil
+}
+
+// VerifyCredentials reports whether CouchDB accepts the name and password,
+// and returns the roles of the user if it does. The credentials are checked
+// by creating a session, but the session cookie is discarded and the client's
+// own credentials are neither used nor changed.
+func (c *Couch) VerifyCredentials(name, password string) (bool, []string, error) {
+	baseURL := c.BaseURL()
+	if baseURL == "" {
+		return false, nil, fmt.Errorf("couch url not valid")
+	}
+	body, err := c.marshal(map[string]string{"name": name, "password": password})
+	if err != nil {
+		return false, nil, err
+	}
+	// Neither basic nor proxy auth of c may be sent along
+	resp, err := c.As(nil).req(
+		"POST",
+		baseURL+"/_session",
+		http.Header{"Content-Type": []string{"application/json"}},
+		body,
+		nil,
+	)
+	if err != nil {
+		return false, nil, err
+	}
+	if resp.StatusCode == 401 {
+		c.readResponse(resp, 401)
+		return false, nil, nil
+	}
+	if resp.StatusCode != 200 {
+		return false, nil, c.couchError(resp)
+	}
+	var v struct {
+		Ok    bool     `json:"ok"`
+		Roles []string `json:"roles"`
+	}
+	if err := c.unmarshalInto(resp, 200, &v); err != nil {
+		return false, nil, err
+	}
+	return v.Ok, v.Roles, nil
+}
+
+// ProxyAuth authenticates requests as user Name with Roles, by setting the
+// X-Auth-CouchDB-* headers of CouchDB's proxy authentication instead of
+// sending credentials. Meant for frontends that authenticate users
+// themselves. If Secret is set, the token proving the headers were set by the
+// frontend is sent as well, which the server requires if
+// proxy_use_secret is enabled.
+type ProxyAuth struct {
+	Name   string
+	Roles  []string
+	Secret string // The couch_httpd_auth/secret of the server
+}
+
+// setHeaders sets the proxy authentication headers of req.
+func (p *ProxyAuth) setHeaders(req *http.Request) {
+	req.Header.Set("X-Auth-CouchDB-UserName", p.Name)
+	req.Header.Set("X-Auth-CouchDB-Roles", strings.Join(p.Roles, ","))
+	if p.Secret != "" {
+		req.Header.Set("X-Auth-CouchDB-Token", ProxyAuthToken(p.Secret, p.Name))
+	}
+}
+
+// ProxyAuthToken returns the X-Auth-CouchDB-Token of username for proxy
+// authentication, the hex encoded HMAC-SHA1 of username keyed with the
+// server's couch_httpd_auth/secret. CouchDB ignores the proxy headers of
+// requests with a wrong token, which are then handled as anonymous.
+func ProxyAuthToken(secret, username string) string {
+	mac := hmac.New(sha1.New, []byte(secret))
+	mac.Write([]byte(username))
+	return hex.EncodeToString(mac.Sum(nil))
+}
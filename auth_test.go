@@ -0,0 +1,191 @@
+package couch
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestGetSecurity(t *testing.T) {
+	couch, srv := newTestCouch(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/mydb/_security" {
+			t.Error("invalid path", r.URL.Path)
+		}
+		w.Write([]byte("{\"admins\":{\"names\":[\"bob\"],\"roles\":[]},\"members\":{\"names\":[],\"roles\":[\"staff\"]}}"))
+	})
+	defer srv.Close()
+	sec, err := couch.GetSecurity()
+	if err != nil {
+		t.Fatal("error not nil", err)
+	}
+	if len(sec.Admins.Names) != 1 || sec.Admins.Names[0] != "bob" || len(sec.Members.Roles) != 1 || sec.Members.Roles[0] != "staff" {
+		t.Fatal("invalid security", sec)
+	}
+}
+
+func TestCanWrite(t *testing.T) {
+	var session, security string
+	couch, srv := newTestCouch(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/_session":
+			w.Write([]byte(session))
+		case "/mydb/_security":
+			switch security {
+			case "401":
+				w.WriteHeader(401)
+				w.Write([]byte("{\"error\":\"unauthorized\",\"reason\":\"You are not authorized to access this db.\"}"))
+			case "403":
+				w.WriteHeader(403)
+				w.Write([]byte("{\"error\":\"forbidden\",\"reason\":\"You are not allowed to access this db.\"}"))
+			default:
+				w.Write([]byte(security))
+			}
+		default:
+			t.Error("invalid path", r.URL.Path)
+		}
+	})
+	defer srv.Close()
+	restricted := "{\"admins\":{\"names\":[\"bob\"],\"roles\":[\"ops\"]},\"members\":{\"names\":[\"carol\"],\"roles\":[\"staff\"]}}"
+	for _, test := range []struct {
+		session, security string
+		ok                bool
+	}{
+		{"{\"ok\":true,\"userCtx\":{\"name\":null,\"roles\":[]}}", "{}", true},
+		{"{\"ok\":true,\"userCtx\":{\"name\":null,\"roles\":[]}}", restricted, false},
+		{"{\"ok\":true,\"userCtx\":{\"name\":\"admin\",\"roles\":[\"_admin\"]}}", restricted, true},
+		{"{\"ok\":true,\"userCtx\":{\"name\":\"bob\",\"roles\":[]}}", restricted, true},
+		{"{\"ok\":true,\"userCtx\":{\"name\":\"dave\",\"roles\":[\"ops\"]}}", restricted, true},
+		{"{\"ok\":true,\"userCtx\":{\"name\":\"carol\",\"roles\":[]}}", restricted, true},
+		{"{\"ok\":true,\"userCtx\":{\"name\":\"erin\",\"roles\":[\"staff\"]}}", restricted, true},
+		{"{\"ok\":true,\"userCtx\":{\"name\":\"frank\",\"roles\":[\"guest\"]}}", restricted, false},
+		{"{\"ok\":true,\"userCtx\":{\"name\":\"frank\",\"roles\":[\"guest\"]}}", "403", false},
+		{"{\"ok\":true,\"userCtx\":{\"name\":null,\"roles\":[]}}", "401", false},
+	} {
+		session, security = test.session, test.security
+		ok, err := couch.CanWrite()
+		if err != nil {
+			t.Fatal("error not nil", err)
+		}
+		if ok != test.ok {
+			t.Fatal("invalid result", ok, test.session, test.security)
+		}
+	}
+}
+
+func TestVerifyCredentials(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" || r.URL.Path != "/_session" {
+			t.Error("invalid request", r.Method, r.URL.Path)
+		}
+		if _, _, ok := r.BasicAuth(); ok {
+			t.Error("client credentials sent")
+		}
+		var v map[string]string
+		if err := json.NewDecoder(r.Body).Decode(&v); err != nil {
+			t.Error("invalid body", err)
+		}
+		switch {
+		case v["name"] == "jan" && v["password"] == "secret":
+			http.SetCookie(w, &http.Cookie{Name: "AuthSession", Value: "abc"})
+			w.Write([]byte("{\"ok\":true,\"name\":\"jan\",\"roles\":[\"staff\"]}"))
+		case v["name"] == "broken":
+			w.WriteHeader(500)
+			w.Write([]byte("{\"error\":\"unknown_error\",\"reason\":\"boom\"}"))
+		default:
+			w.WriteHeader(401)
+			w.Write([]byte("{\"error\":\"unauthorized\",\"reason\":\"Name or password is incorrect.\"}"))
+		}
+	}))
+	defer srv.Close()
+	couch, err := NewCouch(strings.Replace(srv.URL, "http://", "http://admin:pass@", 1) + "/mydb")
+	if err != nil {
+		t.Fatal("error not nil", err)
+	}
+	ok, roles, err := couch.VerifyCredentials("jan", "secret")
+	if err != nil {
+		t.Fatal("error not nil", err)
+	}
+	if !ok || len(roles) != 1 || roles[0] != "staff" {
+		t.Fatal("invalid result", ok, roles)
+	}
+	ok, roles, err = couch.VerifyCredentials("jan", "wrong")
+	if err != nil {
+		t.Fatal("error not nil", err)
+	}
+	if ok || roles != nil {
+		t.Fatal("invalid result", ok, roles)
+	}
+	if _, _, err = couch.VerifyCredentials("broken", "x"); err == nil {
+		t.Fatal("error nil")
+	}
+	if couch.url.User.Username() != "admin" {
+		t.Fatal("client credentials changed", couch.url.User)
+	}
+}
+
+func TestProxyAuth(t *testing.T) {
+	var headers []http.Header
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		headers = append(headers, r.Header)
+		w.Write([]byte("{\"_id\":\"doc\",\"_rev\":\"1-a\"}"))
+	}))
+	defer srv.Close()
+	couch, err := NewCouch(strings.Replace(srv.URL, "http://", "http://admin:secret@", 1) + "/mydb")
+	if err != nil {
+		t.Fatal("error not nil", err)
+	}
+	couch.ProxyAuth = &ProxyAuth{Name: "foo", Roles: []string{"users", "blogger"}}
+	var doc map[string]interface{}
+	if err := couch.Get("doc", &doc); err != nil {
+		t.Fatal("error not nil", err)
+	}
+	couch.ProxyAuth.Secret = "92de07df7e7a3fe14808cef90a7cc0d91"
+	if err := couch.Get("doc", &doc); err != nil {
+		t.Fatal("error not nil", err)
+	}
+	h := headers[0]
+	if h.Get("Authorization") != "" || h.Get("X-Auth-CouchDB-UserName") != "foo" || h.Get("X-Auth-CouchDB-Roles") != "users,blogger" {
+		t.Fatal("invalid headers", h)
+	}
+	if _, ok := h["X-Auth-Couchdb-Token"]; ok {
+		t.Fatal("unexpected token", h)
+	}
+	if token := headers[1].Get("X-Auth-CouchDB-Token"); token != "0a60ae371f04a1f4850c8cc1dffcfa55fddab926" {
+		t.Fatal("invalid token", token)
+	}
+	for _, c := range []*Couch{couch.As(url.UserPassword("bob", "pw")), couch.As(nil)} {
+		if err := c.Get("doc", &doc); err != nil {
+			t.Fatal("error not nil", err)
+		}
+	}
+	if _, _, err := couch.VerifyCredentials("jan", "secret"); err != nil {
+		t.Fatal("error not nil", err)
+	}
+	if len(headers) != 5 {
+		t.Fatal("expected 5 requests", len(headers))
+	}
+	for i, h := range headers[2:] {
+		if h.Get("X-Auth-CouchDB-UserName") != "" || h.Get("X-Auth-CouchDB-Token") != "" {
+			t.Fatal("proxy auth sent", i, h)
+		}
+	}
+	if u, p, _ := (&http.Request{Header: headers[2]}).BasicAuth(); u != "bob" || p != "pw" {
+		t.Fatal("invalid credentials", u, p)
+	}
+	if h := headers[3].Get("Authorization") + headers[4].Get("Authorization"); h != "" {
+		t.Fatal("unexpected credentials", h)
+	}
+}
+
+func TestProxyAuthToken(t *testing.T) {
+	// RFC 2202 test case 2
+	if token := ProxyAuthToken("Jefe", "what do ya want for nothing?"); token != "effcdf6ae5eb2fa2d27416d5f184df9c259a7c79" {
+		t.Fatal("invalid token", token)
+	}
+	if token := ProxyAuthToken("92de07df7e7a3fe14808cef90a7cc0d91", "foo"); token != "0a60ae371f04a1f4850c8cc1dffcfa55fddab926" {
+		t.Fatal("invalid token", token)
+	}
+}
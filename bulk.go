@@ -0,0 +1,233 @@
+package couch
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+)
+
+// BulkGetResult is the outcome of fetching a single document with BulkGet.
+type BulkGetResult struct {
+	Id      Id
+	Rev     Rev             // Current revision, also set for deleted documents
+	Found   bool            // Whether the document exists
+	Deleted bool            // Whether the document existed but was deleted
+	Doc     json.RawMessage // The document, if found
+}
+
+// BulkGet fetches the documents ids in a single _all_docs request. Results
+// are in the order of ids and tell documents that never existed apart from
+// deleted ones.
+func (c *Couch) BulkGet(ids []Id) ([]*BulkGetResult, error) {
+	u, err := c.dbURL("_all_docs?include_docs=true")
+	if err != nil {
+		return nil, err
+	}
+	body, err := c.marshal(map[string][]Id{"keys": ids})
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.req(
+		"POST",
+		u,
+		http.Header{"Content-Type": []string{"application/json"}},
+		body,
+		c.url.User,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != 200 {
+		return nil, c.couchError(resp)
+	}
+	var v struct {
+		Rows []struct {
+			Id    Id     `json:"id"`
+			Key   Id     `json:"key"`
+			Error string `json:"error"`
+			Value struct {
+				Rev     Rev  `json:"rev"`
+				Deleted bool `json:"deleted"`
+			} `json:"value"`
+			Doc json.RawMessage `json:"doc"`
+		} `json:"rows"`
+	}
+	if err := c.unmarshalInto(resp, 200, &v); err != nil {
+		return nil, err
+	}
+	results := make([]*BulkGetResult, 0, len(v.Rows))
+	for _, row := range v.Rows {
+		result := &BulkGetResult{
+			Id:      row.Key,
+			Rev:     row.Value.Rev,
+			Deleted: row.Value.Deleted,
+		}
+		// Missing documents only have a key and an error
+		if row.Error == "" && !row.Value.Deleted {
+			result.Found = true
+			result.Doc = row.Doc
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+// BulkResult is the outcome of writing a single document with _bulk_docs.
+type BulkResult struct {
+	Id     Id     `json:"id"`
+	Rev    Rev    `json:"rev"`    // New revision, if the write succeeded
+	Error  string `json:"error"`  // E.g. "conflict", empty on success
+	Reason string `json:"reason"` // Details about Error
+
+	// DeletedRev is the revision a result of BulkDeleteRevs applies to
+	DeletedRev Rev `json:"-"`
+}
+
+// BulkInsert stores objs with a single _bulk_docs request and returns a
+// result per document, in the order of objs. Like with Insert, documents
+// embedding a Document are updated with their id and new revision. A
+// document that couldn't be stored has the Error of its result set, the
+// returned error is only set if the request as a whole failed.
+func (c *Couch) BulkInsert(objs []interface{}) ([]BulkResult, error) {
+	results, err := c.bulkDocs(objs, true)
+	if err != nil {
+		return nil, err
+	}
+	if len(results) != len(objs) {
+		return nil, fmt.Errorf("expected %d results, got %d", len(objs), len(results))
+	}
+	for i, result := range results {
+		if result.Error == "" {
+			setIdRev(objs[i], result.Id, result.Rev)
+		}
+	}
+	return results, nil
+}
+
+// BulkInsertParallel is like BulkInsert, but splits objs into batches of
+// batchSize documents and sends up to workers batches at the same time, which
+// speeds up large imports. Results are in the order of objs. If a batch fails
+// as a whole, no further batches are sent and the first such error is
+// returned.
+func (c *Couch) BulkInsertParallel(objs []interface{}, batchSize, workers int) ([]BulkResult, error) {
+	if batchSize < 1 {
+		return nil, fmt.Errorf("invalid batch size %d", batchSize)
+	}
+	if workers < 1 {
+		workers = 1
+	}
+	results := make([]BulkResult, len(objs))
+	batches := make(chan int)
+	stop := make(chan struct{})
+	var (
+		wg       sync.WaitGroup
+		once     sync.Once
+		firstErr error
+	)
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for start := range batches {
+				end := start + batchSize
+				if end > len(objs) {
+					end = len(objs)
+				}
+				batch, err := c.BulkInsert(objs[start:end])
+				if err != nil {
+					once.Do(func() {
+						firstErr = err
+						close(stop)
+					})
+					continue
+				}
+				copy(results[start:end], batch)
+			}
+		}()
+	}
+feed:
+	for start := 0; start < len(objs); start += batchSize {
+		select {
+		case batches <- start:
+		case <-stop:
+			break feed
+		}
+	}
+	close(batches)
+	wg.Wait()
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	return results, nil
+}
+
+// BulkDelete deletes the documents in docs, mapping ids to their current
+// revisions, in a single _bulk_docs request. Results are ordered by id. A
+// document that couldn't be deleted has the Error of its result set, the
+// returned error is only set if the request as a whole failed.
+func (c *Couch) BulkDelete(docs map[Id]Rev) ([]BulkResult, error) {
+	revs := make(map[Id][]Rev, len(docs))
+	for id, rev := range docs {
+		revs[id] = []Rev{rev}
+	}
+	return c.BulkDeleteRevs(revs)
+}
+
+// BulkDeleteRevs is like BulkDelete, but deletes several revisions per
+// document. This is how the losing branches of a conflicted document are
+// removed, by deleting each of the conflicting revisions. There is one result
+// per revision, ordered by id and then in the order of the given revisions,
+// with DeletedRev set to the revision it applies to.
+func (c *Couch) BulkDeleteRevs(docs map[Id][]Rev) ([]BulkResult, error) {
+	ids := make([]string, 0, len(docs))
+	for id := range docs {
+		ids = append(ids, string(id))
+	}
+	sort.Strings(ids)
+	var tombstones []interface{}
+	var deleted []Rev
+	for _, id := range ids {
+		for _, rev := range docs[Id(id)] {
+			tombstones = append(tombstones, map[string]interface{}{
+				"_id":      id,
+				"_rev":     rev,
+				"_deleted": true,
+			})
+			deleted = append(deleted, rev)
+		}
+	}
+	results, err := c.bulkDocs(tombstones, true)
+	if err != nil {
+		return nil, err
+	}
+	if len(results) != len(deleted) {
+		return nil, fmt.Errorf("expected %d results, got %d", len(deleted), len(results))
+	}
+	// Results are in the order of the request
+	for i := range results {
+		results[i].DeletedRev = deleted[i]
+	}
+	return results, nil
+}
+
+// bulkDocs writes docs with a single _bulk_docs request. If newEdits is false
+// the documents are stored with the revisions they have, as replication does,
+// and only failed writes are reported.
+func (c *Couch) bulkDocs(docs []interface{}, newEdits bool) ([]BulkResult, error) {
+	u, err := c.dbURL("_bulk_docs")
+	if err != nil {
+		return nil, err
+	}
+	// 202 means the writes were accepted but not yet committed to a quorum
+	body := map[string]interface{}{"docs": docs}
+	if !newEdits {
+		body["new_edits"] = false
+	}
+	var results []BulkResult
+	if _, err := c.doJSON("POST", u, body, &results); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
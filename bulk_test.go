@@ -0,0 +1,214 @@
+package couch
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestBulkGet(t *testing.T) {
+	couch := &Couch{}
+	if _, err := couch.BulkGet([]Id{"a"}); err == nil {
+		t.Fatal("error nil")
+	}
+	couch, srv := newTestCouch(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" || r.URL.Path != "/mydb/_all_docs" || r.URL.Query().Get("include_docs") != "true" {
+			t.Error("invalid request", r.Method, r.URL)
+		}
+		b, _ := ioutil.ReadAll(r.Body)
+		if string(b) != "{\"keys\":[\"present\",\"missing\",\"deleted\"]}" {
+			t.Error("invalid body", string(b))
+		}
+		w.Write([]byte("{\"total_rows\":2,\"offset\":null,\"rows\":[" +
+			"{\"id\":\"present\",\"key\":\"present\",\"value\":{\"rev\":\"1-a\"},\"doc\":{\"_id\":\"present\",\"_rev\":\"1-a\",\"x\":1}}," +
+			"{\"key\":\"missing\",\"error\":\"not_found\"}," +
+			"{\"id\":\"deleted\",\"key\":\"deleted\",\"value\":{\"rev\":\"2-b\",\"deleted\":true},\"doc\":null}]}"))
+	})
+	defer srv.Close()
+	results, err := couch.BulkGet([]Id{"present", "missing", "deleted"})
+	if err != nil {
+		t.Fatal("error not nil", err)
+	}
+	if len(results) != 3 {
+		t.Fatal("expected 3 results", results)
+	}
+	if r := results[0]; r.Id != "present" || r.Rev != "1-a" || !r.Found || r.Deleted ||
+		string(r.Doc) != "{\"_id\":\"present\",\"_rev\":\"1-a\",\"x\":1}" {
+		t.Fatal("invalid result", r)
+	}
+	if r := results[1]; r.Id != "missing" || r.Rev != "" || r.Found || r.Deleted || r.Doc != nil {
+		t.Fatal("invalid result", r)
+	}
+	if r := results[2]; r.Id != "deleted" || r.Rev != "2-b" || r.Found || !r.Deleted || r.Doc != nil {
+		t.Fatal("invalid result", r)
+	}
+}
+
+func TestBulkDelete(t *testing.T) {
+	couch, srv := newTestCouch(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" || r.URL.Path != "/mydb/_bulk_docs" {
+			t.Error("invalid request", r.Method, r.URL.Path)
+		}
+		var v struct {
+			Docs []map[string]interface{} `json:"docs"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&v); err != nil {
+			t.Error("invalid body", err)
+		}
+		if len(v.Docs) != 2 || v.Docs[0]["_id"] != "a" || v.Docs[0]["_rev"] != "1-a" || v.Docs[0]["_deleted"] != true ||
+			v.Docs[1]["_id"] != "b" || v.Docs[1]["_rev"] != "2-b" || v.Docs[1]["_deleted"] != true {
+			t.Error("invalid docs", v.Docs)
+		}
+		w.WriteHeader(201)
+		w.Write([]byte("[{\"ok\":true,\"id\":\"a\",\"rev\":\"2-c\"},{\"id\":\"b\",\"error\":\"conflict\",\"reason\":\"Document update conflict.\"}]"))
+	})
+	defer srv.Close()
+	results, err := couch.BulkDelete(map[Id]Rev{"b": "2-b", "a": "1-a"})
+	if err != nil {
+		t.Fatal("error not nil", err)
+	}
+	if len(results) != 2 || results[0].Id != "a" || results[0].Rev != "2-c" || results[0].Error != "" {
+		t.Fatal("invalid results", results)
+	}
+	if results[1].Id != "b" || results[1].Error != "conflict" || results[1].Reason == "" {
+		t.Fatal("invalid results", results)
+	}
+}
+
+func TestBulkDeleteRevs(t *testing.T) {
+	couch, srv := newTestCouch(t, func(w http.ResponseWriter, r *http.Request) {
+		var v struct {
+			Docs []map[string]interface{} `json:"docs"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&v); err != nil {
+			t.Error("invalid body", err)
+		}
+		w.WriteHeader(201)
+		if len(v.Docs) == 1 {
+			w.Write([]byte("[]"))
+			return
+		}
+		if len(v.Docs) != 3 || v.Docs[0]["_rev"] != "3-x" || v.Docs[1]["_rev"] != "3-y" || v.Docs[2]["_id"] != "b" {
+			t.Error("invalid docs", v.Docs)
+		}
+		w.Write([]byte("[{\"ok\":true,\"id\":\"a\",\"rev\":\"4-x\"},{\"id\":\"a\",\"error\":\"conflict\",\"reason\":\"Document update conflict.\"}," +
+			"{\"ok\":true,\"id\":\"b\",\"rev\":\"2-b\"}]"))
+	})
+	defer srv.Close()
+	results, err := couch.BulkDeleteRevs(map[Id][]Rev{"b": {"1-b"}, "a": {"3-x", "3-y"}})
+	if err != nil {
+		t.Fatal("error not nil", err)
+	}
+	if len(results) != 3 {
+		t.Fatal("expected 3 results", results)
+	}
+	if results[0].DeletedRev != "3-x" || results[0].Rev != "4-x" || results[0].Error != "" {
+		t.Fatal("invalid result", results[0])
+	}
+	if results[1].DeletedRev != "3-y" || results[1].Error != "conflict" {
+		t.Fatal("invalid result", results[1])
+	}
+	if results[2].Id != "b" || results[2].DeletedRev != "1-b" {
+		t.Fatal("invalid result", results[2])
+	}
+	if _, err = couch.BulkDeleteRevs(map[Id][]Rev{"a": {"1-a"}}); err == nil {
+		t.Fatal("error nil")
+	}
+}
+
+func TestBulkInsert(t *testing.T) {
+	couch, srv := newTestCouch(t, func(w http.ResponseWriter, r *http.Request) {
+		var v struct {
+			Docs []map[string]interface{} `json:"docs"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&v); err != nil {
+			t.Error("invalid body", err)
+		}
+		if _, ok := v.Docs[0]["_id"]; ok || v.Docs[1]["_id"] != "b" || v.Docs[1]["n"] != float64(2) {
+			t.Error("invalid docs", v.Docs)
+		}
+		w.WriteHeader(201)
+		w.Write([]byte("[{\"ok\":true,\"id\":\"gen\",\"rev\":\"1-a\"},{\"id\":\"b\",\"error\":\"conflict\",\"reason\":\"Document update conflict.\"}]"))
+	})
+	defer srv.Close()
+	type item struct {
+		Document
+		N int `json:"n"`
+	}
+	a, b := &item{N: 1}, &item{Document: Document{Id: "b"}, N: 2}
+	results, err := couch.BulkInsert([]interface{}{a, b})
+	if err != nil {
+		t.Fatal("error not nil", err)
+	}
+	if len(results) != 2 || results[0].Rev != "1-a" || results[1].Error != "conflict" {
+		t.Fatal("invalid results", results)
+	}
+	if a.Id != "gen" || a.Rev != "1-a" || b.Rev != "" {
+		t.Fatal("invalid id and rev", a, b)
+	}
+}
+
+func TestBulkInsertParallel(t *testing.T) {
+	var running, maxRunning int32
+	couch, srv := newTestCouch(t, func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&running, 1)
+		defer atomic.AddInt32(&running, -1)
+		for {
+			m := atomic.LoadInt32(&maxRunning)
+			if n <= m || atomic.CompareAndSwapInt32(&maxRunning, m, n) {
+				break
+			}
+		}
+		var v struct {
+			Docs []map[string]interface{} `json:"docs"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&v); err != nil {
+			t.Error("invalid body", err)
+		}
+		if len(v.Docs) > 2 {
+			t.Error("batch too large", len(v.Docs))
+		}
+		var results []map[string]interface{}
+		for _, doc := range v.Docs {
+			if doc["_id"] == "fail" {
+				w.WriteHeader(500)
+				w.Write([]byte("{\"error\":\"unknown_error\",\"reason\":\"boom\"}"))
+				return
+			}
+			results = append(results, map[string]interface{}{"ok": true, "id": doc["_id"], "rev": "1-x"})
+		}
+		time.Sleep(5 * time.Millisecond)
+		writeJSON(w, 201, results)
+	})
+	defer srv.Close()
+	var objs []interface{}
+	for i := 0; i < 9; i++ {
+		objs = append(objs, map[string]interface{}{"_id": strconv.Itoa(i)})
+	}
+	results, err := couch.BulkInsertParallel(objs, 2, 3)
+	if err != nil {
+		t.Fatal("error not nil", err)
+	}
+	if len(results) != 9 {
+		t.Fatal("expected 9 results", results)
+	}
+	for i, result := range results {
+		if result.Id != Id(strconv.Itoa(i)) || result.Rev != "1-x" {
+			t.Fatal("results out of order", i, result)
+		}
+	}
+	if m := atomic.LoadInt32(&maxRunning); m > 3 {
+		t.Fatal("invalid concurrency", m)
+	}
+	objs[4] = map[string]interface{}{"_id": "fail"}
+	if _, err = couch.BulkInsertParallel(objs, 2, 3); err == nil {
+		t.Fatal("error nil")
+	}
+	if _, err = couch.BulkInsertParallel(objs, 0, 3); err == nil {
+		t.Fatal("error nil")
+	}
+}
@@ -0,0 +1,104 @@
+package couch
+
+import (
+	"container/list"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// DocCache is a least recently used cache of documents for Get, see
+// Couch.Cache. It's safe for concurrent use and may be shared by clients.
+type DocCache struct {
+	mu    sync.Mutex
+	size  int
+	order *list.List // Most recently used first
+	items map[string]*list.Element
+}
+
+type cacheEntry struct {
+	key  string
+	rev  Rev
+	body []byte
+}
+
+// NewDocCache returns a cache holding up to size documents.
+func NewDocCache(size int) *DocCache {
+	return &DocCache{
+		size:  size,
+		order: list.New(),
+		items: make(map[string]*list.Element),
+	}
+}
+
+// Len returns the number of cached documents.
+func (dc *DocCache) Len() int {
+	dc.mu.Lock()
+	defer dc.mu.Unlock()
+	return dc.order.Len()
+}
+
+func (dc *DocCache) get(key string) (Rev, []byte, bool) {
+	dc.mu.Lock()
+	defer dc.mu.Unlock()
+	el, ok := dc.items[key]
+	if !ok {
+		return "", nil, false
+	}
+	dc.order.MoveToFront(el)
+	e := el.Value.(*cacheEntry)
+	return e.rev, e.body, true
+}
+
+func (dc *DocCache) put(key string, rev Rev, body []byte) {
+	dc.mu.Lock()
+	defer dc.mu.Unlock()
+	if el, ok := dc.items[key]; ok {
+		e := el.Value.(*cacheEntry)
+		e.rev, e.body = rev, body
+		dc.order.MoveToFront(el)
+		return
+	}
+	dc.items[key] = dc.order.PushFront(&cacheEntry{key: key, rev: rev, body: body})
+	for dc.order.Len() > dc.size {
+		el := dc.order.Back()
+		dc.order.Remove(el)
+		delete(dc.items, el.Value.(*cacheEntry).key)
+	}
+}
+
+// getCached is Get with c.Cache set. A cached document is revalidated with
+// its revision as If-None-Match, and only decoded again from the cache if
+// CouchDB responds with 304 Not Modified.
+func (c *Couch) getCached(id Id, obj interface{}) error {
+	u, err := c.docURL(id)
+	if err != nil {
+		return err
+	}
+	rev, cached, ok := c.Cache.get(u)
+	var headers http.Header
+	if ok {
+		headers = http.Header{"If-None-Match": []string{"\"" + string(rev) + "\""}}
+	}
+	resp, err := c.req("GET", u, headers, nil, c.url.User)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode == 304 && ok {
+		if _, err := c.readResponse(resp, 304); err != nil {
+			return err
+		}
+		return c.unmarshal(cached, obj)
+	}
+	if resp.StatusCode != 200 {
+		return c.couchError(resp)
+	}
+	body, err := c.readResponse(resp, 200)
+	if err != nil {
+		return err
+	}
+	if etag := strings.Trim(resp.Header.Get("ETag"), "\""); etag != "" {
+		c.Cache.put(u, Rev(etag), body)
+	}
+	return c.unmarshal(body, obj)
+}
@@ -0,0 +1,59 @@
+package couch
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestDocCache(t *testing.T) {
+	revs := map[string]string{"a": "1-a", "b": "1-b", "c": "1-c"}
+	var full, notModified int
+	couch, srv := newTestCouch(t, func(w http.ResponseWriter, r *http.Request) {
+		id := strings.TrimPrefix(r.URL.Path, "/mydb/")
+		rev, ok := revs[id]
+		if !ok {
+			writeJSON(w, 404, map[string]string{"error": "not_found", "reason": "missing"})
+			return
+		}
+		etag := "\"" + rev + "\""
+		w.Header().Set("ETag", etag)
+		if r.Header.Get("If-None-Match") == etag {
+			notModified++
+			w.WriteHeader(304)
+			return
+		}
+		full++
+		writeJSON(w, 200, map[string]string{"_id": id, "_rev": rev})
+	})
+	defer srv.Close()
+	couch.Cache = NewDocCache(2)
+	get := func(id Id) string {
+		var doc map[string]string
+		if err := couch.Get(id, &doc); err != nil {
+			t.Fatal("error not nil", err)
+		}
+		return doc["_rev"]
+	}
+	get("a")
+	if rev := get("a"); rev != "1-a" || full != 1 || notModified != 1 {
+		t.Fatal("expected cached document", rev, full, notModified)
+	}
+	revs["a"] = "2-a"
+	if rev := get("a"); rev != "2-a" || full != 2 {
+		t.Fatal("expected changed document", rev, full)
+	}
+	get("b")
+	get("c") // Evicts a
+	if couch.Cache.Len() != 2 {
+		t.Fatal("invalid cache size", couch.Cache.Len())
+	}
+	get("a")
+	if full != 5 || notModified != 1 {
+		t.Fatal("expected evicted document", full, notModified)
+	}
+	var doc map[string]string
+	if err := couch.Get("missing", &doc); err == nil {
+		t.Fatal("error nil")
+	}
+}
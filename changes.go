@@ -0,0 +1,352 @@
+package couch
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// Seq is a database update sequence. CouchDB 1.x uses integers while later
+// versions use opaque strings, both are kept as string so they can be passed
+// back as since value.
+type Seq string
+
+func (s *Seq) UnmarshalJSON(b []byte) error {
+	if bytes.Equal(b, []byte("null")) {
+		*s = ""
+		return nil
+	}
+	if len(b) > 0 && b[0] == '"' {
+		var str string
+		if err := json.Unmarshal(b, &str); err != nil {
+			return err
+		}
+		*s = Seq(str)
+		return nil
+	}
+	*s = Seq(b)
+	return nil
+}
+
+// SinceNow can be passed as since value to only get changes made after the
+// request, so a feed can be tailed without replaying its history.
+const SinceNow = "now"
+
+// Change is a single entry of the changes feed.
+type Change struct {
+	Seq     Seq
+	Id      Id
+	Changes []Rev // Leaf revisions of the document
+	Deleted bool
+}
+
+// ChangesResult is a batch of changes. LastSeq is the since value to use for
+// the next request.
+type ChangesResult struct {
+	Results []*Change
+	LastSeq Seq
+	Pending uint64
+}
+
+// ChangesOptions are the query parameters of a changes request. Zero values
+// aren't sent.
+type ChangesOptions struct {
+	Feed    string        // "normal" (the default), "longpoll" or "continuous"
+	Since   string        // Sent as is, not JSON encoded, see SinceNow
+	Timeout time.Duration // How long a longpoll request waits for changes
+	Limit   int
+
+	// Filter only returns the changes accepted by the filter function, given
+	// as "ddoc/name". FilterParams are sent along in the query string, where
+	// the function reads them from req.query.
+	Filter       string
+	FilterParams url.Values
+
+	// Descending returns the changes newest first, e.g. to show the most
+	// recent activity with Limit. Since then inverts too: the feed starts
+	// at the end and only changes up to since are returned.
+	Descending bool
+
+	// Heartbeat makes CouchDB send a newline after this much time without
+	// changes, which keeps idle connections from being closed by proxies
+	// and load balancers. Sent in milliseconds.
+	Heartbeat time.Duration
+
+	// SeqInterval makes CouchDB 2.0+ only compute the seq of every
+	// SeqInterval-th change, the others have an empty Seq. This speeds up
+	// feeds that are consumed in batches and only checkpoint LastSeq.
+	SeqInterval int
+
+	// Extra are additional query parameters, for server features without a
+	// field. They are sent as is and replace the parameters set by the other
+	// fields.
+	Extra url.Values
+}
+
+func (o ChangesOptions) values() url.Values {
+	v := url.Values{}
+	if o.Feed != "" {
+		v.Set("feed", o.Feed)
+	}
+	if o.Since != "" {
+		v.Set("since", o.Since)
+	}
+	if o.Timeout > 0 {
+		v.Set("timeout", strconv.FormatInt(int64(o.Timeout/time.Millisecond), 10))
+	}
+	if o.Limit > 0 {
+		v.Set("limit", strconv.Itoa(o.Limit))
+	}
+	if o.Descending {
+		v.Set("descending", "true")
+	}
+	if o.SeqInterval > 0 {
+		v.Set("seq_interval", strconv.Itoa(o.SeqInterval))
+	}
+	if o.Heartbeat > 0 {
+		v.Set("heartbeat", strconv.FormatInt(int64(o.Heartbeat/time.Millisecond), 10))
+	}
+	if o.Filter != "" {
+		v.Set("filter", o.Filter)
+	}
+	for k, vs := range o.FilterParams {
+		v[k] = vs
+	}
+	for k, vs := range o.Extra {
+		v[k] = vs
+	}
+	return v
+}
+
+// Changes returns the changes of the database selected by opts.
+func (c *Couch) Changes(ctx context.Context, opts ChangesOptions) (*ChangesResult, error) {
+	return c.changes(ctx, opts.values())
+}
+
+// ChangesLongpoll returns the changes after since. If there are none the
+// request blocks until a change happens, timeout passes or ctx is done. An
+// empty since starts at the beginning of the feed, SinceNow at its end. since
+// is sent as is, not JSON encoded. A zero timeout uses the server default.
+func (c *Couch) ChangesLongpoll(ctx context.Context, since string, timeout time.Duration) (*ChangesResult, error) {
+	return c.Changes(ctx, ChangesOptions{
+		Feed:    "longpoll",
+		Since:   since,
+		Timeout: timeout,
+	})
+}
+
+func (c *Couch) changes(ctx context.Context, params url.Values) (*ChangesResult, error) {
+	u, err := c.dbURL("_changes?" + params.Encode())
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.reqBody(
+		ctx,
+		"GET",
+		u,
+		"",
+		nil,
+		nil,
+		0,
+		c.url.User,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != 200 {
+		return nil, c.couchError(resp)
+	}
+	var v struct {
+		Results []*changeRow `json:"results"`
+		LastSeq Seq          `json:"last_seq"`
+		Pending uint64       `json:"pending"`
+	}
+	if err := c.unmarshalInto(resp, 200, &v); err != nil {
+		return nil, err
+	}
+	result := &ChangesResult{
+		Results: make([]*Change, 0, len(v.Results)),
+		LastSeq: v.LastSeq,
+		Pending: v.Pending,
+	}
+	for _, r := range v.Results {
+		result.Results = append(result.Results, r.change())
+	}
+	return result, nil
+}
+
+// changeRow is a change as sent by CouchDB.
+type changeRow struct {
+	Seq     Seq  `json:"seq"`
+	Id      Id   `json:"id"`
+	Deleted bool `json:"deleted"`
+	Changes []struct {
+		Rev Rev `json:"rev"`
+	} `json:"changes"`
+	LastSeq *Seq `json:"last_seq"` // Only set on the last line of a continuous feed
+}
+
+func (r *changeRow) change() *Change {
+	change := &Change{
+		Seq:     r.Seq,
+		Id:      r.Id,
+		Changes: make([]Rev, 0, len(r.Changes)),
+		Deleted: r.Deleted,
+	}
+	for _, ch := range r.Changes {
+		change.Changes = append(change.Changes, ch.Rev)
+	}
+	return change
+}
+
+// ChangesContinuous follows the continuous changes feed selected by opts and
+// calls fn for each change as it arrives. It returns when the feed ends,
+// after opts.Timeout without changes or opts.Limit changes, when ctx is done
+// or when fn returns an error, which is returned. The returned Seq is the
+// since value to resume the feed with. Set opts.Heartbeat to keep idle
+// connections open, the heartbeat newlines are skipped.
+func (c *Couch) ChangesContinuous(ctx context.Context, opts ChangesOptions, fn func(change *Change) error) (Seq, error) {
+	opts.Feed = "continuous"
+	u, err := c.dbURL("_changes?" + opts.values().Encode())
+	if err != nil {
+		return "", err
+	}
+	resp, err := c.reqBody(ctx, "GET", u, "", nil, nil, 0, c.url.User)
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode != 200 {
+		return "", c.couchError(resp)
+	}
+	defer resp.Body.Close()
+	last := Seq(opts.Since)
+	r := bufio.NewReader(resp.Body)
+	for {
+		line, err := r.ReadBytes('\n')
+		if len(bytes.TrimSpace(line)) > 0 {
+			row := &changeRow{}
+			if err := c.unmarshal(line, row); err != nil {
+				return last, err
+			}
+			if row.LastSeq != nil {
+				return *row.LastSeq, nil
+			}
+			if row.Seq != "" {
+				last = row.Seq
+			}
+			if err := fn(row.change()); err != nil {
+				return last, err
+			}
+		}
+		if err == io.EOF {
+			return last, nil
+		}
+		if err != nil {
+			return last, err
+		}
+	}
+}
+
+// ChangesCheckpoint is the position of a changes consumer in the feed of
+// database Db, meant to be persisted as JSON so the consumer can resume after
+// a restart with ResumeChanges. Numeric seqs, as stored by CouchDB 1.x
+// consumers, are read as well. An empty Db stands for the database of the
+// client it's resumed with.
+type ChangesCheckpoint struct {
+	Db  string `json:"db"`
+	Seq Seq    `json:"seq"`
+}
+
+// Update advances cp past change. Changes without a seq, see
+// ChangesOptions.SeqInterval, leave cp as is.
+func (cp *ChangesCheckpoint) Update(change Change) {
+	if change.Seq != "" {
+		cp.Seq = change.Seq
+	}
+}
+
+const (
+	minResumeDelay = 100 * time.Millisecond
+	maxResumeDelay = 30 * time.Second
+)
+
+// ResumeChanges follows the continuous changes feed after cp.Seq and sends
+// each change to the returned channel, reconnecting whenever the server ends
+// the feed. Reconnects after a feed without changes are delayed, doubling up
+// to 30s, so a server that keeps closing the feed isn't hammered. The
+// consumer persists its position by calling Update on a copy of cp with each
+// change it handled. The channel is closed when ctx is done or the feed
+// fails, and the error channel then receives the reason. cp.Db must be the
+// database of c, or empty. opts.Since is ignored and opts.Limit is rejected,
+// since it would end every feed after Limit changes.
+func (c *Couch) ResumeChanges(ctx context.Context, cp ChangesCheckpoint, opts ChangesOptions) (<-chan Change, <-chan error) {
+	changes := make(chan Change)
+	errc := make(chan error, 1)
+	if cp.Db != "" && cp.Db != c.Db() {
+		close(changes)
+		errc <- fmt.Errorf("checkpoint of database %q, not %q", cp.Db, c.Db())
+		return changes, errc
+	}
+	if opts.Limit > 0 {
+		close(changes)
+		errc <- fmt.Errorf("limit not supported when resuming changes")
+		return changes, errc
+	}
+	go func() {
+		defer close(changes)
+		errc <- c.resumeChanges(ctx, cp.Seq, opts, changes)
+	}()
+	return changes, errc
+}
+
+func (c *Couch) resumeChanges(ctx context.Context, since Seq, opts ChangesOptions, changes chan<- Change) error {
+	var delay time.Duration
+	for {
+		opts.Since = string(since)
+		n := 0
+		last, err := c.ChangesContinuous(ctx, opts, func(change *Change) error {
+			select {
+			case changes <- *change:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+			n++
+			if change.Seq != "" {
+				since = change.Seq
+			}
+			return nil
+		})
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err != nil {
+			return err
+		}
+		if last != "" {
+			since = last
+		}
+		switch {
+		case n > 0:
+			delay = 0
+			continue
+		case delay == 0:
+			delay = minResumeDelay
+		case delay < maxResumeDelay:
+			delay *= 2
+			if delay > maxResumeDelay {
+				delay = maxResumeDelay
+			}
+		}
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
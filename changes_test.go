@@ -0,0 +1,351 @@
+package couch
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSeq(t *testing.T) {
+	var v struct {
+		A, B, C Seq
+	}
+	err := json.Unmarshal([]byte("{\"A\":12,\"B\":\"12-g1AAAA\",\"C\":null}"), &v)
+	if err != nil {
+		t.Fatal("error not nil", err)
+	}
+	if v.A != "12" || v.B != "12-g1AAAA" || v.C != "" {
+		t.Fatal("invalid seqs", v)
+	}
+}
+
+func TestChangesLongpoll(t *testing.T) {
+	couch := &Couch{}
+	if _, err := couch.ChangesLongpoll(context.Background(), "", 0); err == nil {
+		t.Fatal("error nil")
+	}
+	couch, srv := newTestCouch(t, func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		if r.URL.Path != "/mydb/_changes" {
+			t.Error("invalid path", r.URL.Path)
+		}
+		if q.Get("feed") != "longpoll" || q.Get("since") != "3-abc" || q.Get("timeout") != "5000" {
+			t.Error("invalid query", r.URL.RawQuery)
+		}
+		w.Write([]byte("{\"results\":[" +
+			"{\"seq\":\"4-def\",\"id\":\"doc1\",\"changes\":[{\"rev\":\"2-a\"},{\"rev\":\"2-b\"}]}," +
+			"{\"seq\":\"5-ghi\",\"id\":\"doc2\",\"changes\":[{\"rev\":\"3-c\"}],\"deleted\":true}]," +
+			"\"last_seq\":\"5-ghi\",\"pending\":1}"))
+	})
+	defer srv.Close()
+	result, err := couch.ChangesLongpoll(context.Background(), "3-abc", 5*time.Second)
+	if err != nil {
+		t.Fatal("error not nil", err)
+	}
+	if result.LastSeq != "5-ghi" || result.Pending != 1 || len(result.Results) != 2 {
+		t.Fatal("invalid result", result)
+	}
+	if c := result.Results[0]; c.Seq != "4-def" || c.Id != "doc1" || len(c.Changes) != 2 || c.Changes[1] != "2-b" || c.Deleted {
+		t.Fatal("invalid change", c)
+	}
+	if c := result.Results[1]; c.Id != "doc2" || !c.Deleted {
+		t.Fatal("invalid change", c)
+	}
+}
+
+func TestChangesLongpollCancel(t *testing.T) {
+	done := make(chan struct{})
+	couch, srv := newTestCouch(t, func(w http.ResponseWriter, r *http.Request) {
+		// Block like a longpoll without changes
+		select {
+		case <-r.Context().Done():
+		case <-done:
+		}
+	})
+	defer srv.Close()
+	defer close(done)
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := couch.ChangesLongpoll(ctx, "now", 0); err == nil {
+		t.Fatal("error nil")
+	}
+}
+
+func TestChangesSinceNow(t *testing.T) {
+	couch, srv := newTestCouch(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.RawQuery != "feed=longpoll&since=now" {
+			t.Error("invalid query", r.URL.RawQuery)
+		}
+		w.Write([]byte("{\"results\":[],\"last_seq\":\"9-xyz\",\"pending\":0}"))
+	})
+	defer srv.Close()
+	result, err := couch.ChangesLongpoll(context.Background(), SinceNow, 0)
+	if err != nil {
+		t.Fatal("error not nil", err)
+	}
+	if result.LastSeq != "9-xyz" || len(result.Results) != 0 {
+		t.Fatal("invalid result", result)
+	}
+}
+
+func TestChanges(t *testing.T) {
+	couch, srv := newTestCouch(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.RawQuery != "limit=100&seq_interval=50&since=10" {
+			t.Error("invalid query", r.URL.RawQuery)
+		}
+		w.Write([]byte("{\"results\":[" +
+			"{\"seq\":null,\"id\":\"doc1\",\"changes\":[{\"rev\":\"1-a\"}]}," +
+			"{\"seq\":12,\"id\":\"doc2\",\"changes\":[{\"rev\":\"1-b\"}]}]," +
+			"\"last_seq\":12,\"pending\":0}"))
+	})
+	defer srv.Close()
+	result, err := couch.Changes(context.Background(), ChangesOptions{
+		Since:       "10",
+		Limit:       100,
+		SeqInterval: 50,
+	})
+	if err != nil {
+		t.Fatal("error not nil", err)
+	}
+	if result.LastSeq != "12" || len(result.Results) != 2 {
+		t.Fatal("invalid result", result)
+	}
+	if result.Results[0].Seq != "" || result.Results[1].Seq != "12" {
+		t.Fatal("invalid seqs", result.Results[0], result.Results[1])
+	}
+}
+
+func TestChangesDescending(t *testing.T) {
+	couch, srv := newTestCouch(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.RawQuery != "descending=true&include_docs=true&limit=2" {
+			t.Error("invalid query", r.URL.RawQuery)
+		}
+		w.Write([]byte("{\"results\":[" +
+			"{\"seq\":\"9-i\",\"id\":\"doc9\",\"changes\":[{\"rev\":\"1-a\"}]}," +
+			"{\"seq\":\"8-h\",\"id\":\"doc8\",\"changes\":[{\"rev\":\"1-b\"}]}]," +
+			"\"last_seq\":\"8-h\",\"pending\":7}"))
+	})
+	defer srv.Close()
+	result, err := couch.Changes(context.Background(), ChangesOptions{
+		Descending: true,
+		Limit:      2,
+		Extra:      url.Values{"include_docs": {"true"}},
+	})
+	if err != nil {
+		t.Fatal("error not nil", err)
+	}
+	if len(result.Results) != 2 || result.Results[0].Id != "doc9" || result.LastSeq != "8-h" {
+		t.Fatal("invalid result", result)
+	}
+}
+
+func TestChangesFilter(t *testing.T) {
+	couch, srv := newTestCouch(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.RawQuery != "filter=app%2Fby_tenant&since=3&tenant=acme&type=order" {
+			t.Error("invalid query", r.URL.RawQuery)
+		}
+		w.Write([]byte("{\"results\":[{\"seq\":\"4\",\"id\":\"o1\",\"changes\":[{\"rev\":\"1-a\"}]}],\"last_seq\":\"4\"}"))
+	})
+	defer srv.Close()
+	result, err := couch.Changes(context.Background(), ChangesOptions{
+		Since:        "3",
+		Filter:       "app/by_tenant",
+		FilterParams: url.Values{"tenant": {"acme"}, "type": {"order"}},
+	})
+	if err != nil {
+		t.Fatal("error not nil", err)
+	}
+	if len(result.Results) != 1 || result.Results[0].Id != "o1" {
+		t.Fatal("invalid result", result)
+	}
+}
+
+// idleConn fails reads after d without data, like a load balancer closing
+// idle connections.
+type idleConn struct {
+	net.Conn
+	d time.Duration
+}
+
+func (c *idleConn) Read(p []byte) (int, error) {
+	c.SetReadDeadline(time.Now().Add(c.d))
+	return c.Conn.Read(p)
+}
+
+func TestChangesContinuous(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		if r.URL.Path != "/mydb/_changes" || q.Get("feed") != "continuous" || q.Get("since") != "5-a" {
+			t.Error("invalid request", r.URL)
+		}
+		heartbeat, _ := strconv.Atoi(q.Get("heartbeat"))
+		w.Write([]byte("{\"seq\":\"6-b\",\"id\":\"a\",\"changes\":[{\"rev\":\"1-a\"}]}\n"))
+		w.(http.Flusher).Flush()
+		// Stay idle for 30ms, sending heartbeats if requested
+		for i := 0; i < 3; i++ {
+			select {
+			case <-r.Context().Done():
+				return
+			case <-time.After(10 * time.Millisecond):
+			}
+			if heartbeat > 0 {
+				w.Write([]byte("\n"))
+				w.(http.Flusher).Flush()
+			}
+		}
+		w.Write([]byte("{\"seq\":\"7-c\",\"id\":\"b\",\"changes\":[{\"rev\":\"2-b\"}],\"deleted\":true}\n"))
+		w.Write([]byte("{\"last_seq\":\"7-c\",\"pending\":0}\n"))
+	}))
+	defer srv.Close()
+	transport := &http.Transport{
+		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			conn, err := (&net.Dialer{}).DialContext(ctx, network, addr)
+			if err != nil {
+				return nil, err
+			}
+			return &idleConn{Conn: conn, d: 20 * time.Millisecond}, nil
+		},
+	}
+	couch, err := NewCouchWithOptions(srv.URL+"/mydb", Options{Transport: transport})
+	if err != nil {
+		t.Fatal("error not nil", err)
+	}
+	var changes []*Change
+	collect := func(change *Change) error {
+		changes = append(changes, change)
+		return nil
+	}
+	opts := ChangesOptions{Since: "5-a", Heartbeat: 10 * time.Millisecond}
+	last, err := couch.ChangesContinuous(context.Background(), opts, collect)
+	if err != nil {
+		t.Fatal("error not nil", err)
+	}
+	if last != "7-c" || len(changes) != 2 || changes[0].Id != "a" || changes[1].Id != "b" || !changes[1].Deleted {
+		t.Fatal("invalid changes", last, changes)
+	}
+	changes = nil
+	last, err = couch.ChangesContinuous(context.Background(), ChangesOptions{Since: "5-a"}, collect)
+	if err == nil {
+		t.Fatal("idle feed without heartbeat not closed")
+	}
+	if last != "6-b" || len(changes) != 1 {
+		t.Fatal("invalid changes", last, changes)
+	}
+	stop := errors.New("stop")
+	last, err = couch.ChangesContinuous(context.Background(), opts, func(change *Change) error { return stop })
+	if err != stop || last != "6-b" {
+		t.Fatal("expected stop", last, err)
+	}
+}
+
+func TestResumeChanges(t *testing.T) {
+	var mu sync.Mutex
+	var sinces []string
+	couch, srv := newTestCouch(t, func(w http.ResponseWriter, r *http.Request) {
+		since := r.URL.Query().Get("since")
+		mu.Lock()
+		sinces = append(sinces, since)
+		mu.Unlock()
+		switch since {
+		case "":
+			w.Write([]byte("{\"seq\":1,\"id\":\"a\",\"changes\":[{\"rev\":\"1-a\"}]}\n{\"last_seq\":1}\n"))
+		case "1":
+			w.Write([]byte("{\"seq\":2,\"id\":\"b\",\"changes\":[{\"rev\":\"1-b\"}]}\n"))
+			w.Write([]byte("{\"seq\":3,\"id\":\"c\",\"changes\":[{\"rev\":\"1-c\"}]}\n{\"last_seq\":3}\n"))
+		case "3":
+			<-r.Context().Done()
+		default:
+			t.Error("invalid since", since)
+		}
+	})
+	defer srv.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	cp := ChangesCheckpoint{}
+	changes, errc := couch.ResumeChanges(ctx, cp, ChangesOptions{})
+	var ids []Id
+	for change := range changes {
+		ids = append(ids, change.Id)
+		if change.Id == "c" {
+			cancel()
+			break
+		}
+		cp.Update(change)
+	}
+	if err := <-errc; err != context.Canceled {
+		t.Fatal("expected canceled", err)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(ids) != 3 || cp.Seq != "2" || len(sinces) < 2 || sinces[1] != "1" {
+		t.Fatal("invalid checkpoint", ids, cp, sinces)
+	}
+	cp.Db = couch.Db()
+	b, err := json.Marshal(cp)
+	if err != nil {
+		t.Fatal("error not nil", err)
+	}
+	if string(b) != "{\"db\":\"mydb\",\"seq\":\"2\"}" {
+		t.Fatal("invalid json", string(b))
+	}
+	var restored ChangesCheckpoint
+	if err := json.Unmarshal([]byte("{\"db\":\"other\",\"seq\":2}"), &restored); err != nil {
+		t.Fatal("error not nil", err)
+	}
+	if restored.Seq != "2" || restored.Db != "other" {
+		t.Fatal("invalid checkpoint", restored)
+	}
+	var fresh ChangesCheckpoint
+	if b, err = json.Marshal(fresh); err != nil {
+		t.Fatal("error not nil", err)
+	}
+	if err := json.Unmarshal(b, &fresh); err != nil || fresh.Db != "" || fresh.Seq != "" {
+		t.Fatal("invalid round trip", fresh, err)
+	}
+	changes, errc = couch.ResumeChanges(context.Background(), restored, ChangesOptions{})
+	if _, ok := <-changes; ok {
+		t.Fatal("expected closed channel")
+	}
+	if err := <-errc; err == nil {
+		t.Fatal("expected database mismatch")
+	}
+	_, errc = couch.ResumeChanges(context.Background(), cp, ChangesOptions{Limit: 10})
+	if err := <-errc; err == nil {
+		t.Fatal("expected limit error")
+	}
+}
+
+func TestResumeChangesBackoff(t *testing.T) {
+	var mu sync.Mutex
+	requests := 0
+	couch, srv := newTestCouch(t, func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests++
+		mu.Unlock()
+		w.Write([]byte("{\"last_seq\":1}\n"))
+	})
+	defer srv.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 250*time.Millisecond)
+	defer cancel()
+	changes, errc := couch.ResumeChanges(ctx, ChangesCheckpoint{}, ChangesOptions{})
+	for range changes {
+		t.Fatal("unexpected change")
+	}
+	if err := <-errc; err != context.DeadlineExceeded {
+		t.Fatal("expected deadline", err)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	// Reconnects at 100ms and 300ms
+	if requests != 2 {
+		t.Fatal("invalid number of requests", requests)
+	}
+}
@@ -0,0 +1,138 @@
+package couch
+
+import (
+	"fmt"
+)
+
+// Shards returns the shards of the database on a cluster, mapping each
+// document id hash range, like "00000000-7fffffff", to the nodes holding a
+// copy of it.
+func (c *Couch) Shards() (map[string][]string, error) {
+	u, err := c.dbURL("_shards")
+	if err != nil {
+		return nil, err
+	}
+	var v struct {
+		Shards map[string][]string `json:"shards"`
+	}
+	if err := c.getJSON(u, &v); err != nil {
+		return nil, err
+	}
+	return v.Shards, nil
+}
+
+// ShardsForDoc returns the nodes holding the shard document id is stored in.
+// The document doesn't need to exist.
+func (c *Couch) ShardsForDoc(id Id) ([]string, error) {
+	u, err := c.dbURL("_shards/" + escapeSegment(string(id)))
+	if err != nil {
+		return nil, err
+	}
+	var v struct {
+		Range string   `json:"range"`
+		Nodes []string `json:"nodes"`
+	}
+	if err := c.getJSON(u, &v); err != nil {
+		return nil, err
+	}
+	return v.Nodes, nil
+}
+
+// ReshardEvent is an entry in the history of a resharding job.
+type ReshardEvent struct {
+	Timestamp string `json:"timestamp"`
+	Type      string `json:"type"`
+	Detail    string `json:"detail"`
+}
+
+// ReshardJob is a shard splitting job of CouchDB 3.0 and later.
+type ReshardJob struct {
+	Id         string   `json:"id"`
+	Type       string   `json:"type"`        // Always "split" for now
+	JobState   string   `json:"job_state"`   // E.g. "new", "running", "completed" or "failed"
+	SplitState string   `json:"split_state"` // Step of the split, e.g. "copy_local_docs"
+	Node       string   `json:"node"`
+	Source     string   `json:"source"` // Shard being split
+	Target     []string `json:"target"`
+	StartTime  string   `json:"start_time"`
+	UpdateTime string   `json:"update_time"`
+	StateInfo  struct {
+		Reason string `json:"reason"`
+	} `json:"state_info"`
+	History []ReshardEvent `json:"history"`
+}
+
+// StartReshard splits all shards of database db in two and returns the ids of
+// the created jobs, one per shard copy. Only admins may reshard, others get an
+// error matching ErrForbidden or ErrUnauthorized.
+func (c *Couch) StartReshard(db string) ([]string, error) {
+	var v []struct {
+		Ok     bool   `json:"ok"`
+		Id     string `json:"id"`
+		Error  string `json:"error"`
+		Reason string `json:"reason"`
+	}
+	body := map[string]string{"type": "split", "db": db}
+	if _, err := c.Do("POST", "/_reshard/jobs", body, &v, nil); err != nil {
+		return nil, err
+	}
+	ids := make([]string, 0, len(v))
+	for _, job := range v {
+		if !job.Ok {
+			return ids, fmt.Errorf("reshard failed: %s (%s)", job.Error, job.Reason)
+		}
+		ids = append(ids, job.Id)
+	}
+	return ids, nil
+}
+
+// ReshardJobs returns all resharding jobs of the cluster, to monitor their
+// progress.
+func (c *Couch) ReshardJobs() ([]ReshardJob, error) {
+	var v struct {
+		Jobs []ReshardJob `json:"jobs"`
+	}
+	if _, err := c.Do("GET", "/_reshard/jobs", nil, &v, nil); err != nil {
+		return nil, err
+	}
+	return v.Jobs, nil
+}
+
+// SystemStats are the Erlang VM statistics of a node. Memory sizes are in
+// bytes.
+type SystemStats struct {
+	Uptime int64 `json:"uptime"` // Seconds
+	Memory struct {
+		Other         uint64 `json:"other"`
+		Atom          uint64 `json:"atom"`
+		AtomUsed      uint64 `json:"atom_used"`
+		Processes     uint64 `json:"processes"`
+		ProcessesUsed uint64 `json:"processes_used"`
+		Binary        uint64 `json:"binary"`
+		Code          uint64 `json:"code"`
+		Ets           uint64 `json:"ets"`
+	} `json:"memory"`
+	RunQueue                int    `json:"run_queue"` // Processes ready to run, a sustained high value means the node is overloaded
+	EtsTableCount           int    `json:"ets_table_count"`
+	ContextSwitches         uint64 `json:"context_switches"`
+	Reductions              uint64 `json:"reductions"`
+	GarbageCollectionCount  uint64 `json:"garbage_collection_count"`
+	WordsReclaimed          uint64 `json:"words_reclaimed"`
+	IoInput                 uint64 `json:"io_input"`
+	IoOutput                uint64 `json:"io_output"`
+	OsProcCount             int    `json:"os_proc_count"`
+	StaleProcCount          int    `json:"stale_proc_count"`
+	ProcessCount            int    `json:"process_count"`
+	ProcessLimit            int    `json:"process_limit"`
+	InternalReplicationJobs int    `json:"internal_replication_jobs"`
+}
+
+// System returns the VM statistics of the node handling the request, on
+// CouchDB 2.0 and later. Only admins may read them.
+func (c *Couch) System() (*SystemStats, error) {
+	stats := &SystemStats{}
+	if _, err := c.Do("GET", "/_node/_local/_system", nil, stats, nil); err != nil {
+		return nil, err
+	}
+	return stats, nil
+}
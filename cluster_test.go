@@ -0,0 +1,110 @@
+package couch
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+)
+
+func TestShards(t *testing.T) {
+	couch, srv := newTestCouch(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.EscapedPath() {
+		case "/mydb/_shards":
+			w.Write([]byte("{\"shards\":{\"00000000-7fffffff\":[\"node1@a\",\"node2@b\"],\"80000000-ffffffff\":[\"node1@a\"]}}"))
+		case "/mydb/_shards/a%2Fb":
+			w.Write([]byte("{\"range\":\"80000000-ffffffff\",\"nodes\":[\"node1@a\"]}"))
+		default:
+			t.Error("invalid path", r.URL.EscapedPath())
+			w.WriteHeader(404)
+		}
+	})
+	defer srv.Close()
+	shards, err := couch.Shards()
+	if err != nil {
+		t.Fatal("error not nil", err)
+	}
+	if len(shards) != 2 || len(shards["00000000-7fffffff"]) != 2 || shards["80000000-ffffffff"][0] != "node1@a" {
+		t.Fatal("invalid shards", shards)
+	}
+	nodes, err := couch.ShardsForDoc("a/b")
+	if err != nil {
+		t.Fatal("error not nil", err)
+	}
+	if len(nodes) != 1 || nodes[0] != "node1@a" {
+		t.Fatal("invalid nodes", nodes)
+	}
+}
+
+func TestStartReshard(t *testing.T) {
+	forbidden := false
+	couch, srv := newTestCouch(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/_reshard/jobs" {
+			t.Error("invalid path", r.URL.Path)
+		}
+		if forbidden {
+			w.WriteHeader(403)
+			w.Write([]byte("{\"error\":\"forbidden\",\"reason\":\"You are not a server admin.\"}"))
+			return
+		}
+		switch r.Method {
+		case "POST":
+			var v map[string]string
+			if err := json.NewDecoder(r.Body).Decode(&v); err != nil {
+				t.Error("invalid body", err)
+			}
+			if v["type"] != "split" || v["db"] != "big" {
+				t.Error("invalid body", v)
+			}
+			w.WriteHeader(201)
+			w.Write([]byte("[{\"ok\":true,\"id\":\"001-a\",\"node\":\"node1@a\",\"shard\":\"shards/00000000-ffffffff/big.1\"}," +
+				"{\"ok\":true,\"id\":\"001-b\",\"node\":\"node2@b\",\"shard\":\"shards/00000000-ffffffff/big.1\"}]"))
+		case "GET":
+			w.Write([]byte("{\"jobs\":[{\"id\":\"001-a\",\"type\":\"split\",\"job_state\":\"running\",\"split_state\":\"copy_local_docs\"," +
+				"\"source\":\"shards/00000000-ffffffff/big.1\",\"target\":[\"shards/00000000-7fffffff/big.1\",\"shards/80000000-ffffffff/big.1\"]," +
+				"\"history\":[{\"timestamp\":\"2019-03-28T15:28:02Z\",\"type\":\"new\",\"detail\":null}]}],\"offset\":0,\"total_rows\":1}"))
+		}
+	})
+	defer srv.Close()
+	ids, err := couch.StartReshard("big")
+	if err != nil {
+		t.Fatal("error not nil", err)
+	}
+	if len(ids) != 2 || ids[0] != "001-a" || ids[1] != "001-b" {
+		t.Fatal("invalid ids", ids)
+	}
+	jobs, err := couch.ReshardJobs()
+	if err != nil {
+		t.Fatal("error not nil", err)
+	}
+	if len(jobs) != 1 || jobs[0].JobState != "running" || len(jobs[0].Target) != 2 || len(jobs[0].History) != 1 {
+		t.Fatal("invalid jobs", jobs)
+	}
+	forbidden = true
+	if _, err := couch.StartReshard("big"); !errors.Is(err, ErrForbidden) {
+		t.Fatal("expected forbidden", err)
+	}
+	if _, err := couch.ReshardJobs(); !errors.Is(err, ErrForbidden) || errors.Is(err, ErrUnauthorized) {
+		t.Fatal("expected forbidden", err)
+	}
+}
+
+func TestSystem(t *testing.T) {
+	couch, srv := newTestCouch(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/_node/_local/_system" {
+			t.Error("invalid path", r.URL.Path)
+		}
+		w.Write([]byte("{\"uptime\":259,\"memory\":{\"other\":18036184,\"atom\":504433,\"atom_used\":488328," +
+			"\"processes\":9161448,\"processes_used\":9160864,\"binary\":275608,\"code\":11369970,\"ets\":1520472}," +
+			"\"run_queue\":3,\"ets_table_count\":115,\"context_switches\":1254,\"reductions\":2304218," +
+			"\"process_count\":296,\"process_limit\":262144,\"message_queues\":{\"couch_file\":{\"count\":2}}}"))
+	})
+	defer srv.Close()
+	stats, err := couch.System()
+	if err != nil {
+		t.Fatal("error not nil", err)
+	}
+	if stats.Uptime != 259 || stats.RunQueue != 3 || stats.ProcessCount != 296 || stats.Memory.Processes != 9161448 || stats.Memory.Ets != 1520472 {
+		t.Fatal("invalid stats", stats)
+	}
+}
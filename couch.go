@@ -2,12 +2,19 @@ package couch
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
+	"log"
 	"net/http"
 	"net/url"
+	"reflect"
+	"sort"
 	"strings"
+	"time"
 )
 
 type (
@@ -15,10 +22,60 @@ type (
 	Rev string
 )
 
+// Document maps the id and revision of a document to _id and _rev. Embed it
+// in document types to have them filled in by Get and kept current by Update.
+type Document struct {
+	Id  Id  `json:"_id,omitempty"`
+	Rev Rev `json:"_rev,omitempty"`
+}
+
+func (d *Document) document() *Document {
+	return d
+}
+
+// documenter is implemented by pointers to types embedding Document.
+type documenter interface {
+	document() *Document
+}
+
+// setIdRev stores id and rev in obj, if it embeds a Document or is a pointer
+// to a struct with string fields tagged _id and _rev. Maps are left as is, so
+// writing the same map again doesn't carry over the _id and _rev of the
+// first document.
+func setIdRev(obj interface{}, id Id, rev Rev) {
+	if d, ok := obj.(documenter); ok {
+		doc := d.document()
+		doc.Id, doc.Rev = id, rev
+		return
+	}
+	setTagged(obj, map[string]string{"_id": string(id), "_rev": string(rev)})
+}
+
+// setTagged sets the string fields of obj, a pointer to a struct, whose JSON
+// name is a key of values to its value.
+func setTagged(obj interface{}, values map[string]string) {
+	v := reflect.ValueOf(obj)
+	if v.Kind() != reflect.Ptr || v.IsNil() || v.Elem().Kind() != reflect.Struct {
+		return
+	}
+	v = v.Elem()
+	for i := 0; i < v.NumField(); i++ {
+		f := v.Field(i)
+		if !f.CanSet() || f.Kind() != reflect.String {
+			continue
+		}
+		name := strings.Split(v.Type().Field(i).Tag.Get("json"), ",")[0]
+		if value, ok := values[name]; ok {
+			f.SetString(value)
+		}
+	}
+}
+
 type Row struct {
 	Id    Id
 	Key   interface{}
 	Value interface{}
+	Doc   json.RawMessage // Only set for queries with include_docs=true
 }
 
 type Result struct {
@@ -39,7 +96,7 @@ const (
 	PDescending    = "descending"     // change the direction of search
 	PSkip          = "skip"           // skip n number of documents
 	PGroup         = "group"          // The group option controls whether the reduce function reduces to a set of distinct keys or to a single result row.
-	PGroupLevel    = "group_level"    // 
+	PGroupLevel    = "group_level"    // group array keys up to the given number of elements
 	PReduce        = "reduce"         // use the reduce function of the view. It defaults to true, if a reduce function is defined and to false otherwise.
 	PIncludeDocs   = "include_docs"   // automatically fetch and include the document which emitted each view entry
 	PInclusiveEnd  = "inclusive_end"  // Controls whether the endkey is included in the result. It defaults to true.
@@ -47,21 +104,187 @@ const (
 )
 
 type Couch struct {
-	url  *url.URL
-	send func(req *http.Request) (*http.Response, error)
+	url    *url.URL
+	client *http.Client
+	send   func(req *http.Request) (*http.Response, error)
+
+	// MaxResponseBytes limits the size of response bodies read into memory.
+	// Zero means unlimited.
+	MaxResponseBytes int64
+
+	// Marshal and Unmarshal encode request bodies and decode responses,
+	// e.g. to use a faster JSON package or custom time formats. They default
+	// to encoding/json.
+	Marshal   func(v interface{}) ([]byte, error)
+	Unmarshal func(data []byte, v interface{}) error
+
+	// URLFunc, if set, builds the URLs of requests to the database instead of
+	// joining base, db and path, e.g. to map them onto a rewrite or virtual
+	// host. base is the server URL, db the escaped database name and path the
+	// escaped path in the database, which may be empty and may include a
+	// query string. Requests relative to the server root are not affected.
+	URLFunc func(base, db, path string) string
+
+	// PrettyJSON indents the JSON request bodies encoded with encoding/json,
+	// which makes captured traffic easier to read.
+	PrettyJSON bool
+
+	// Logger, if set, logs the method, URL and body of requests with a body.
+	Logger *log.Logger
+
+	// AutoRev makes Update fetch the current revision of the document when
+	// no revision is given, so it overwrites whatever is stored. Off by
+	// default, since it defeats the conflict detection of updates.
+	AutoRev bool
+
+	// OnResponse, if set, is called with every response before it's read,
+	// e.g. to log the X-Couch-Request-Id header CouchDB sets, which
+	// identifies the request in the server logs.
+	OnResponse func(resp *http.Response)
+
+	// ProxyAuth, if set, authenticates requests with proxy authentication
+	// headers instead of the credentials of the URL.
+	ProxyAuth *ProxyAuth
+
+	// CoalesceGets makes concurrent identical document and JSON reads, like
+	// Get of the same document by many goroutines, share a single request
+	// and its response. Clients created with DB and As share the in-flight
+	// requests of c.
+	CoalesceGets bool
+	flights      *flightGroup
+
+	// Cache, if set, keeps the documents read by Get. CouchDB is still
+	// asked whether a cached document changed, but unchanged documents
+	// aren't transferred again.
+	Cache *DocCache
+
+	// MutateRetries is how often Mutate repeats its cycle on update
+	// conflicts. Zero means 5.
+	MutateRetries int
+
+	// QueryMultiWorkers is how many queries QueryMulti runs at the same
+	// time. Zero means 4.
+	QueryMultiWorkers int
+
+	// PurgeBatchSize is how many documents PurgeExpired purges per request.
+	// Zero means 100.
+	PurgeBatchSize int
+
+	// RestoreBatchSize is how many documents Restore writes per request.
+	// Zero means 100.
+	RestoreBatchSize int
+}
+
+// Options configures a Couch created with NewCouchWithOptions. The zero value
+// gives the defaults used by NewCouch.
+type Options struct {
+	// Transport sends the requests. Defaults to http.DefaultTransport, which
+	// uses HTTP/2 with servers supporting it over TLS, so concurrent
+	// requests share a connection. A custom http.Transport needs
+	// ForceAttemptHTTP2 set for this.
+	Transport http.RoundTripper
+
+	// Timeout limits the time of a request, including reading the response.
+	// Zero means no timeout.
+	Timeout time.Duration
+
+	// MaxResponseBytes limits the size of response bodies read into memory.
+	// Zero means unlimited.
+	MaxResponseBytes int64
+
+	// CheckRedirect is the redirect policy, see http.Client. Defaults to
+	// following up to 10 redirects.
+	CheckRedirect func(req *http.Request, via []*http.Request) error
+
+	// RedirectAuth re-attaches the credentials when a redirect leads to
+	// another host, which net/http doesn't do by default.
+	RedirectAuth bool
+
+	// Marshal and Unmarshal replace encoding/json, see Couch.
+	Marshal   func(v interface{}) ([]byte, error)
+	Unmarshal func(data []byte, v interface{}) error
 }
 
 func NewCouch(rawurl string) (*Couch, error) {
+	return NewCouchWithOptions(rawurl, Options{})
+}
+
+// NewCouchWithOptions is like NewCouch but configures the client with opts.
+func NewCouchWithOptions(rawurl string, opts Options) (*Couch, error) {
 	u, err := url.Parse(rawurl)
 	if err != nil {
 		return nil, err
 	}
-	return &Couch{
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("couch url %q must use http or https", rawurl)
+	}
+	if u.Host == "" {
+		return nil, fmt.Errorf("couch url %q has no host", rawurl)
+	}
+	c := &Couch{
 		url: u,
-		send: func(req *http.Request) (*http.Response, error) {
-			return http.DefaultClient.Do(req)
+		client: &http.Client{
+			Transport:     opts.Transport,
+			Timeout:       opts.Timeout,
+			CheckRedirect: opts.CheckRedirect,
 		},
-	}, nil
+		MaxResponseBytes: opts.MaxResponseBytes,
+		Marshal:          opts.Marshal,
+		Unmarshal:        opts.Unmarshal,
+		flights:          &flightGroup{},
+	}
+	if opts.RedirectAuth {
+		c.client.CheckRedirect = redirectWithAuth(opts.CheckRedirect)
+	}
+	c.send = func(req *http.Request) (*http.Response, error) {
+		return c.client.Do(req)
+	}
+	return c, nil
+}
+
+// redirectWithAuth wraps the redirect policy check to copy the Authorization
+// header of the original request to redirects to other hosts.
+func redirectWithAuth(check func(req *http.Request, via []*http.Request) error) func(req *http.Request, via []*http.Request) error {
+	return func(req *http.Request, via []*http.Request) error {
+		if check != nil {
+			if err := check(req, via); err != nil {
+				return err
+			}
+		} else if len(via) >= 10 {
+			return errors.New("stopped after 10 redirects")
+		}
+		if auth := via[0].Header.Get("Authorization"); auth != "" && req.Header.Get("Authorization") == "" {
+			req.Header.Set("Authorization", auth)
+		}
+		return nil
+	}
+}
+
+// Transport returns the http.RoundTripper used to send requests.
+func (c *Couch) Transport() http.RoundTripper {
+	if c.client != nil && c.client.Transport != nil {
+		return c.client.Transport
+	}
+	return http.DefaultTransport
+}
+
+// SetTransport replaces the http.RoundTripper used to send requests. To add
+// tracing or metrics, wrap the current transport:
+//
+//	c.SetTransport(otelhttp.NewTransport(c.Transport()))
+func (c *Couch) SetTransport(rt http.RoundTripper) {
+	if c.client == nil {
+		c.client = &http.Client{}
+	}
+	c.client.Transport = rt
+}
+
+// Close closes idle connections of the transport. The client can still be
+// used afterwards, new connections are opened as needed.
+func (c *Couch) Close() {
+	if c.client != nil {
+		c.client.CloseIdleConnections()
+	}
 }
 
 func (c *Couch) Secure() bool {
@@ -71,6 +294,8 @@ func (c *Couch) Secure() bool {
 	return false
 }
 
+// Db returns the unescaped name of the database, e.g. "logs/2024" for a
+// client created with the URL http://host/logs%2F2024.
 func (c *Couch) Db() string {
 	db := ""
 	if c.url != nil {
@@ -81,6 +306,38 @@ func (c *Couch) Db() string {
 	return db
 }
 
+// DB returns a client for database name on the same server. It shares the
+// credentials, transport and settings of c, so connections are pooled
+// across all databases. The name is escaped when building URLs, so it may
+// contain characters like "/" or "+".
+func (c *Couch) DB(name string) *Couch {
+	var u url.URL
+	if c.url != nil {
+		u = *c.url
+	}
+	u.Path = "/" + name
+	u.RawPath = ""
+	db := *c
+	db.url = &u
+	return &db
+}
+
+// As returns a client for the same database that sends requests with the
+// credentials of user instead, or without credentials if user is nil. Like
+// DB it shares the transport and settings of c, except ProxyAuth, which would
+// override user.
+func (c *Couch) As(user *url.Userinfo) *Couch {
+	var u url.URL
+	if c.url != nil {
+		u = *c.url
+	}
+	u.User = user
+	as := *c
+	as.url = &u
+	as.ProxyAuth = nil
+	return &as
+}
+
 func (c *Couch) BaseURL() string {
 	if c.url != nil {
 		return c.url.Scheme + "://" + c.url.Host
@@ -96,28 +353,149 @@ func (c *Couch) AllDbsURL() string {
 	return ""
 }
 
+// dbURL returns the URL of path in the database, or of the database itself
+// if path is empty. Returns ErrNoDatabase if the client has no database.
+func (c *Couch) dbURL(path string) (string, error) {
+	base := c.BaseURL()
+	if base == "" {
+		return "", fmt.Errorf("couch url not valid")
+	}
+	db := c.Db()
+	if db == "" {
+		return "", ErrNoDatabase
+	}
+	if c.URLFunc != nil {
+		return c.URLFunc(base, escapeSegment(db), path), nil
+	}
+	u := base + "/" + escapeSegment(db)
+	if path != "" {
+		u += "/" + path
+	}
+	return u, nil
+}
+
+// escapeSegment escapes a database name, document id or other name for use
+// as a single path segment. "+" is escaped as well, since CouchDB would
+// otherwise decode it as a space.
+func escapeSegment(name string) string {
+	return strings.Replace(url.PathEscape(name), "+", "%2B", -1)
+}
+
+// docURL returns the URL of document id. The _design/ and _local/ prefixes
+// of special documents are kept unescaped.
+func (c *Couch) docURL(id Id) (string, error) {
+	prefix, name := "", string(id)
+	for _, p := range []string{"_design/", "_local/"} {
+		if strings.HasPrefix(name, p) {
+			prefix, name = p, name[len(p):]
+			break
+		}
+	}
+	return c.dbURL(prefix + escapeSegment(name))
+}
+
+// AllDbs returns the names of all databases on the server. Like Running it
+// also works on clients without a database.
+func (c *Couch) AllDbs() ([]string, error) {
+	var dbs []string
+	if _, err := c.Do("GET", "/_all_dbs", nil, &dbs, nil); err != nil {
+		return nil, err
+	}
+	return dbs, nil
+}
+
 func (c *Couch) req(method, url string, headers http.Header, body []byte, user *url.Userinfo) (*http.Response, error) {
+	c.logBody(method, url, body)
+	return c.reqBody(context.Background(), method, url, "", headers, bytes.NewReader(body), int64(len(body)), user)
+}
+
+// logBody logs a request body to the Logger, if any. Passwords, like those
+// sent by VerifyCredentials and CreateUser, are redacted.
+func (c *Couch) logBody(method, url string, body []byte) {
+	if c.Logger != nil && len(body) > 0 {
+		c.Logger.Printf("%s %s\n%s", method, url, redactPasswords(body))
+	}
+}
+
+// redactPasswords replaces the values of all "password" fields in the JSON
+// body. Bodies that mention a password but can't be decoded are dropped
+// entirely.
+func redactPasswords(body []byte) []byte {
+	if !bytes.Contains(body, []byte(`"password"`)) {
+		return body
+	}
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return []byte("(body not logged)")
+	}
+	var redact func(v interface{})
+	redact = func(v interface{}) {
+		switch v := v.(type) {
+		case map[string]interface{}:
+			for k, val := range v {
+				if k == "password" {
+					v[k] = "***"
+				} else {
+					redact(val)
+				}
+			}
+		case []interface{}:
+			for _, val := range v {
+				redact(val)
+			}
+		}
+	}
+	redact(v)
+	b, err := json.Marshal(v)
+	if err != nil {
+		return []byte("(body not logged)")
+	}
+	return b
+}
+
+// reqBody sends a request with the body read from r, canceled when ctx is
+// done. headers are sent as given, so callers control e.g. Accept, but if
+// contentType is set it overrides any Content-Type in headers. A negative size
+// sends the body with chunked transfer encoding, otherwise size is used as the
+// Content-Length.
+func (c *Couch) reqBody(ctx context.Context, method, url, contentType string, headers http.Header, r io.Reader, size int64, user *url.Userinfo) (*http.Response, error) {
 	if c.send == nil {
 		panic("send func not set")
 	}
 	// Create a new request
-	req, err := http.NewRequest(method, url, nil)
+	req, err := http.NewRequestWithContext(ctx, method, url, nil)
 	if err != nil {
 		return nil, err
 	}
 
-	req.Close = true
-	req.TransferEncoding = []string{"chunked"}
-	req.Body = ioutil.NopCloser(bytes.NewBuffer(body))
-	req.ContentLength = int64(len(body))
+	if r == nil {
+		r = bytes.NewReader(nil)
+	}
+	if rc, ok := r.(io.ReadCloser); ok {
+		req.Body = rc
+	} else {
+		req.Body = ioutil.NopCloser(r)
+	}
+	if size < 0 {
+		req.TransferEncoding = []string{"chunked"}
+	} else {
+		req.ContentLength = size
+	}
 
-	// Set headers
+	// Set headers, copied since auth and content type are set on them
 	if headers != nil {
-		req.Header = headers
+		req.Header = headers.Clone()
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
 	}
 
 	// Set auth credentials
-	if user != nil {
+	if c.ProxyAuth != nil {
+		c.ProxyAuth.setHeaders(req)
+	} else if user != nil {
 		if p, ok := user.Password(); ok {
 			req.SetBasicAuth(user.Username(), p)
 		}
@@ -127,6 +505,9 @@ func (c *Couch) req(method, url string, headers http.Header, body []byte, user *
 	if err != nil {
 		return nil, err
 	}
+	if c.OnResponse != nil {
+		c.OnResponse(resp)
+	}
 
 	return resp, nil
 }
@@ -140,52 +521,213 @@ func (c *Couch) Running() (bool, error) {
 	if err != nil {
 		return false, err
 	}
-	if resp.StatusCode != 200 {
-		return false, fmt.Errorf("returned invalid status %d", resp.StatusCode)
-	}
-	defer resp.Body.Close()
-	b, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		return false, err
-	}
 	var d map[string]string
-	err = json.Unmarshal(b, &d)
-	if err != nil {
+	if err := c.unmarshalInto(resp, 200, &d); err != nil {
 		return false, err
 	}
 	return (d["version"] != "" && d["couchdb"] == "Welcome"), nil
 }
 
-func verifyAndUnmarshalResponse(resp *http.Response, status int) (map[string]interface{}, error) {
+// readResponse verifies the response status and reads the body. The body is
+// always drained and closed so the connection can be reused, unless it is
+// larger than MaxResponseBytes, in which case an error is returned.
+func (c *Couch) readResponse(resp *http.Response, status int) ([]byte, error) {
+	defer resp.Body.Close()
+	r := io.Reader(resp.Body)
+	if c.MaxResponseBytes > 0 {
+		r = io.LimitReader(resp.Body, c.MaxResponseBytes+1)
+	}
 	if resp.StatusCode != status {
+		io.Copy(ioutil.Discard, r)
 		return nil, fmt.Errorf("returned invalid status %d (expected %d)", resp.StatusCode, status)
 	}
-	defer resp.Body.Close()
-	body, err := ioutil.ReadAll(resp.Body)
+	body, err := ioutil.ReadAll(r)
 	if err != nil {
 		return nil, err
 	}
-	var v map[string]interface{}
-	err = json.Unmarshal(body, &v)
+	if c.MaxResponseBytes > 0 && int64(len(body)) > c.MaxResponseBytes {
+		return nil, fmt.Errorf("response body exceeds %d bytes", c.MaxResponseBytes)
+	}
+	return body, nil
+}
+
+// fetch sends a GET or HEAD like request without body to u, returning non-2xx
+// responses as *CouchError. If stream is true the caller owns the response
+// body and must close it, which streaming methods need to hand the body on.
+// Otherwise the body is read, subject to MaxResponseBytes, and closed. With
+// CoalesceGets set, plain GETs of the same URL in flight share their result.
+func (c *Couch) fetch(method, u string, headers http.Header, stream bool) (*http.Response, []byte, error) {
+	if c.CoalesceGets && c.flights != nil && method == "GET" && headers == nil && !stream {
+		return c.flights.do(c.flightKey(u), func() (*http.Response, []byte, error) {
+			return c.fetchOnce(method, u, headers, stream)
+		})
+	}
+	return c.fetchOnce(method, u, headers, stream)
+}
+
+func (c *Couch) fetchOnce(method, u string, headers http.Header, stream bool) (*http.Response, []byte, error) {
+	resp, err := c.req(method, u, headers, nil, c.url.User)
+	if err != nil {
+		return nil, nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, nil, c.couchError(resp)
+	}
+	if stream {
+		return resp, nil, nil
+	}
+	body, err := c.readResponse(resp, resp.StatusCode)
+	if err != nil {
+		return nil, nil, err
+	}
+	return resp, body, nil
+}
+
+var (
+	ErrNoDatabase = errors.New("no database selected")
+	ErrNotFound   = errors.New("not found")
+	ErrConflict   = errors.New("document update conflict")
+
+	ErrUnauthorized = errors.New("unauthorized")
+	ErrForbidden    = errors.New("forbidden")
+)
+
+// CouchError is returned when CouchDB responds with an error status. Type and
+// Reason hold the error and reason fields of the response body, if any.
+// RequestId is the X-Couch-Request-Id of the response, to find the request in
+// the server logs.
+type CouchError struct {
+	StatusCode int
+	Type       string
+	Reason     string
+	RequestId  string
+}
+
+func (e *CouchError) Error() string {
+	msg := fmt.Sprintf("returned invalid status %d", e.StatusCode)
+	if e.Type != "" {
+		msg += fmt.Sprintf(": %s (%s)", e.Type, e.Reason)
+	}
+	if e.RequestId != "" {
+		msg += ", request id " + e.RequestId
+	}
+	return msg
+}
+
+// Is reports whether the status of e corresponds to target, so that
+// errors.Is(err, ErrConflict) holds for a 409 response.
+func (e *CouchError) Is(target error) bool {
+	switch target {
+	case ErrNotFound:
+		return e.StatusCode == 404
+	case ErrConflict:
+		return e.StatusCode == 409
+	case ErrUnauthorized:
+		return e.StatusCode == 401
+	case ErrForbidden:
+		return e.StatusCode == 403
+	}
+	return false
+}
+
+// couchError reads the error body of resp into a *CouchError.
+func (c *Couch) couchError(resp *http.Response) error {
+	e := &CouchError{
+		StatusCode: resp.StatusCode,
+		RequestId:  resp.Header.Get("X-Couch-Request-Id"),
+	}
+	body, err := c.readResponse(resp, resp.StatusCode)
 	if err != nil {
+		return e
+	}
+	var v struct {
+		Error  string `json:"error"`
+		Reason string `json:"reason"`
+	}
+	if json.Unmarshal(body, &v) == nil {
+		e.Type = v.Error
+		e.Reason = v.Reason
+	}
+	return e
+}
+
+func (c *Couch) verifyAndUnmarshalResponse(resp *http.Response, status int) (map[string]interface{}, error) {
+	var v map[string]interface{}
+	if err := c.unmarshalInto(resp, status, &v); err != nil {
 		return nil, err
 	}
 	return v, nil
 }
 
+func (c *Couch) marshal(v interface{}) ([]byte, error) {
+	if c.Marshal != nil {
+		return c.Marshal(v)
+	}
+	if c.PrettyJSON {
+		return json.MarshalIndent(v, "", "  ")
+	}
+	return json.Marshal(v)
+}
+
+// isNil reports whether obj is nil or a nil pointer.
+func isNil(obj interface{}) bool {
+	v := reflect.ValueOf(obj)
+	return obj == nil || v.Kind() == reflect.Ptr && v.IsNil()
+}
+
+// marshalDoc encodes obj as a document body, which CouchDB only accepts as a
+// JSON object.
+func (c *Couch) marshalDoc(obj interface{}) ([]byte, error) {
+	if isNil(obj) {
+		return nil, fmt.Errorf("document is nil")
+	}
+	body, err := c.marshal(obj)
+	if err != nil {
+		return nil, fmt.Errorf("cannot encode %T document: %v", obj, err)
+	}
+	if b := bytes.TrimSpace(body); len(b) == 0 || b[0] != '{' {
+		return nil, fmt.Errorf("document must encode to a JSON object, %T encodes to %.20s", obj, b)
+	}
+	return body, nil
+}
+
+func (c *Couch) unmarshal(data []byte, v interface{}) error {
+	if c.Unmarshal != nil {
+		return c.Unmarshal(data, v)
+	}
+	return json.Unmarshal(data, v)
+}
+
+// unmarshalInto verifies the response status like readResponse and decodes
+// the JSON body into v. If v is nil, or the body is empty or whitespace as
+// some endpoints respond, the body is only drained and v left unchanged, so
+// callers that need fields must check they are set.
+func (c *Couch) unmarshalInto(resp *http.Response, status int, v interface{}) error {
+	body, err := c.readResponse(resp, status)
+	if err != nil {
+		return err
+	}
+	if v == nil || len(bytes.TrimSpace(body)) == 0 {
+		return nil
+	}
+	return c.unmarshal(body, v)
+}
+
+// Insert stores obj as a new document and returns its id and revision. If obj
+// embeds a Document, or is a pointer to a struct with _id and _rev tagged
+// string fields, they are set to the returned id and revision.
 func (c *Couch) Insert(obj interface{}) (Id, Rev, error) {
-	baseURL := c.BaseURL()
-	db := c.Db()
-	if baseURL == "" || db == "" {
-		return "", "", fmt.Errorf("couch url not valid")
+	u, err := c.dbURL("")
+	if err != nil {
+		return "", "", err
 	}
-	body, err := json.Marshal(obj)
+	body, err := c.marshalDoc(obj)
 	if err != nil {
 		return "", "", err
 	}
 	resp, err := c.req(
 		"POST",
-		baseURL+"/"+db,
+		u,
 		http.Header{"Content-Type": []string{"application/json"}},
 		body,
 		c.url.User,
@@ -193,100 +735,699 @@ func (c *Couch) Insert(obj interface{}) (Id, Rev, error) {
 	if err != nil {
 		return "", "", err
 	}
-	v, err := verifyAndUnmarshalResponse(resp, 201)
-	if err != nil {
+	var v insertResponse
+	if err := c.unmarshalInto(resp, 201, &v); err != nil {
 		return "", "", err
 	}
-	if _, ok := v["id"]; !ok {
+	if v.Id == "" {
 		return "", "", fmt.Errorf("id not set")
 	}
-	if _, ok := v["rev"]; !ok {
+	if v.Rev == "" {
 		return "", "", fmt.Errorf("rev not set")
 	}
-	if x, ok := v["ok"]; !ok || x != true {
+	if !v.Ok {
 		return "", "", fmt.Errorf("ok flag not true")
 	}
-	return Id(v["id"].(string)), Rev(v["rev"].(string)), nil
+	setIdRev(obj, v.Id, v.Rev)
+	return v.Id, v.Rev, nil
+}
+
+// insertResponse is the response to a document write.
+type insertResponse struct {
+	Id  Id   `json:"id"`
+	Rev Rev  `json:"rev"`
+	Ok  bool `json:"ok"`
 }
 
+// Get fetches document id and JSON decodes it into obj. If c.Cache is set, the
+// document is decoded from the cache if it's unchanged.
+func (c *Couch) Get(id Id, obj interface{}) error {
+	if c.Cache != nil {
+		return c.getCached(id, obj)
+	}
+	return c.get(id, nil, obj)
+}
+
+// GetRev fetches revision rev of document id and JSON decodes it into obj. If
+// latest is true and rev has been updated since, the newest leaf revision of
+// its branch is returned instead, which replicators use to fetch the current
+// state of a conflict branch.
+func (c *Couch) GetRev(id Id, rev Rev, latest bool, obj interface{}) error {
+	params := url.Values{"rev": []string{string(rev)}}
+	if latest {
+		params.Set("latest", "true")
+	}
+	return c.get(id, params, obj)
+}
+
+// GetIfModified is like Get but only fetches the document if its revision
+// differs from rev. CouchDB answers with 304 Not Modified otherwise, so the
+// document is neither transferred nor decoded and false is returned.
+func (c *Couch) GetIfModified(id Id, rev Rev, obj interface{}) (bool, error) {
+	u, err := c.docURL(id)
+	if err != nil {
+		return false, err
+	}
+	var headers http.Header
+	if rev != "" {
+		// The ETag of a document is its quoted revision
+		headers = http.Header{"If-None-Match": []string{"\"" + string(rev) + "\""}}
+	}
+	resp, err := c.req("GET", u, headers, nil, c.url.User)
+	if err != nil {
+		return false, err
+	}
+	if resp.StatusCode == 304 {
+		_, err := c.readResponse(resp, 304)
+		return false, err
+	}
+	if resp.StatusCode != 200 {
+		return false, c.couchError(resp)
+	}
+	if err := c.unmarshalInto(resp, 200, obj); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// Revisions is the revision history of a document. Ids holds the revision
+// hashes, newest first, the first one belonging to generation Start.
+type Revisions struct {
+	Start int      `json:"start"`
+	Ids   []string `json:"ids"`
+}
+
+// Revs returns the full revisions of the history, newest first.
+func (r Revisions) Revs() []Rev {
+	revs := make([]Rev, 0, len(r.Ids))
+	for i, id := range r.Ids {
+		revs = append(revs, Rev(fmt.Sprintf("%d-%s", r.Start-i, id)))
+	}
+	return revs
+}
+
+// GetWithRevisions fetches document id with revs=true and returns the
+// document along with its revision history.
+func (c *Couch) GetWithRevisions(id Id) (json.RawMessage, Revisions, error) {
+	var doc json.RawMessage
+	if err := c.get(id, url.Values{"revs": []string{"true"}}, &doc); err != nil {
+		return nil, Revisions{}, err
+	}
+	var v struct {
+		Revisions Revisions `json:"_revisions"`
+	}
+	if err := c.unmarshal(doc, &v); err != nil {
+		return nil, Revisions{}, err
+	}
+	return doc, v.Revisions, nil
+}
+
+func (c *Couch) get(id Id, params url.Values, obj interface{}) error {
+	u, err := c.docURL(id)
+	if err != nil {
+		return err
+	}
+	if len(params) > 0 {
+		u += "?" + params.Encode()
+	}
+	return c.getJSON(u, obj)
+}
+
+// getJSON requests u and decodes the JSON response into v.
+func (c *Couch) getJSON(u string, v interface{}) error {
+	_, body, err := c.fetch("GET", u, nil, false)
+	if err != nil {
+		return err
+	}
+	return c.unmarshal(body, v)
+}
+
+// Update stores obj as document id. rev must be the current revision of the
+// document, or empty if the document doesn't exist yet. If rev is outdated the
+// returned error matches ErrConflict. Returns the new revision.
+//
+// If obj embeds a Document and rev is empty, the revision of the Document is
+// used. On success the Document is updated with id and the new revision. If
+// there still is no revision and AutoRev is set, the current revision is
+// fetched first.
+func (c *Couch) Update(id Id, rev Rev, obj interface{}) (Rev, error) {
+	if isNil(obj) {
+		return "", fmt.Errorf("document is nil")
+	}
+	if d, ok := obj.(documenter); ok && rev == "" {
+		rev = d.document().Rev
+	}
+	if rev == "" && c.AutoRev {
+		var err error
+		if rev, err = c.Rev(id); err != nil && !errors.Is(err, ErrNotFound) {
+			return "", err
+		}
+	}
+	return c.put(id, rev, obj)
+}
+
+// Create stores obj as new document id. Unlike Update it never overwrites,
+// also not with AutoRev set or the revision of an embedded Document, so if
+// the id is taken the returned error matches ErrConflict. Returns the
+// revision.
+func (c *Couch) Create(id Id, obj interface{}) (Rev, error) {
+	if isNil(obj) {
+		return "", fmt.Errorf("document is nil")
+	}
+	return c.put(id, "", obj)
+}
+
+// put writes obj as revision rev of document id.
+func (c *Couch) put(id Id, rev Rev, obj interface{}) (Rev, error) {
+	u, err := c.docURL(id)
+	if err != nil {
+		return "", err
+	}
+	var body []byte
+	if d, ok := obj.(documenter); ok {
+		// The body rev must match the one we update, but the caller's stays
+		// as is in case the write fails
+		doc := d.document()
+		prev := doc.Rev
+		doc.Rev = rev
+		body, err = c.marshalDoc(obj)
+		doc.Rev = prev
+	} else {
+		body, err = c.marshalDoc(obj)
+	}
+	if err != nil {
+		return "", err
+	}
+	if rev != "" {
+		u += "?rev=" + url.QueryEscape(string(rev))
+	}
+	resp, err := c.req(
+		"PUT",
+		u,
+		http.Header{"Content-Type": []string{"application/json"}},
+		body,
+		c.url.User,
+	)
+	if err != nil {
+		return "", err
+	}
+	// 202 means the write was accepted but not yet committed to a quorum
+	if resp.StatusCode != 201 && resp.StatusCode != 202 {
+		return "", c.couchError(resp)
+	}
+	var v insertResponse
+	if err := c.unmarshalInto(resp, resp.StatusCode, &v); err != nil {
+		return "", err
+	}
+	if v.Rev == "" {
+		return "", fmt.Errorf("rev not set")
+	}
+	setIdRev(obj, id, v.Rev)
+	return v.Rev, nil
+}
+
+// Rev returns the current revision of document id, without fetching the
+// document. The error matches ErrNotFound if the document doesn't exist.
+func (c *Couch) Rev(id Id) (Rev, error) {
+	u, err := c.docURL(id)
+	if err != nil {
+		return "", err
+	}
+	resp, _, err := c.fetch("HEAD", u, nil, false)
+	if err != nil {
+		return "", err
+	}
+	rev := Rev(strings.Trim(resp.Header.Get("ETag"), "\""))
+	if rev == "" {
+		return "", fmt.Errorf("etag not set")
+	}
+	return rev, nil
+}
+
+// GetRevOnly returns the current revision of document id like Rev, but reads
+// it from _all_docs instead of the ETag of a HEAD request. The error matches
+// ErrNotFound if the document doesn't exist or is deleted.
+func (c *Couch) GetRevOnly(id Id) (Rev, error) {
+	result, err := c.QueryOpts("_all_docs", nil, ViewOptions{Key: string(id)})
+	if err != nil {
+		return "", err
+	}
+	for _, row := range result.Rows {
+		if row.Id != id {
+			continue
+		}
+		value, _ := row.Value.(map[string]interface{})
+		if rev, _ := value["rev"].(string); rev != "" {
+			return Rev(rev), nil
+		}
+		return "", fmt.Errorf("rev not set")
+	}
+	return "", &CouchError{StatusCode: 404, Type: "not_found", Reason: "missing"}
+}
+
+// Upsert stores obj as document id whether or not it exists, overwriting the
+// current revision. The document is written with the revision of obj, if it
+// has one, and on a conflict the current revision is fetched, set in obj and
+// the write retried once. Returns the new revision.
+func (c *Couch) Upsert(id Id, obj interface{}) (Rev, error) {
+	rev, err := c.Update(id, "", obj)
+	if !errors.Is(err, ErrConflict) {
+		return rev, err
+	}
+	current, err := c.Rev(id)
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		return "", err
+	}
+	setRev(obj, current)
+	return c.Update(id, current, obj)
+}
+
+// setRev sets the _rev of obj to rev if obj is a map with a _rev or a pointer
+// to a struct with a string field tagged _rev, so the body rev of a write
+// doesn't differ from the one in the query. Embedded Documents are set by put.
+func setRev(obj interface{}, rev Rev) {
+	m, ok := obj.(map[string]interface{})
+	if !ok {
+		setTagged(obj, map[string]string{"_rev": string(rev)})
+		return
+	}
+	if rev == "" {
+		delete(m, "_rev")
+	} else if _, ok := m["_rev"]; ok {
+		m["_rev"] = string(rev)
+	}
+}
+
+func (c *Couch) mutateRetries() int {
+	if c.MutateRetries > 0 {
+		return c.MutateRetries
+	}
+	return 5
+}
+
+// Mutate reads document id, applies fn to it and writes it back. If the
+// document was changed in the meantime the whole cycle is repeated, up to
+// c.MutateRetries times. An error returned by fn aborts without writing.
+// Returns the new revision.
+func (c *Couch) Mutate(id Id, fn func(doc map[string]interface{}) error) (Rev, error) {
+	for i := 0; ; i++ {
+		var doc map[string]interface{}
+		if err := c.Get(id, &doc); err != nil {
+			return "", err
+		}
+		rev, _ := doc["_rev"].(string)
+		if err := fn(doc); err != nil {
+			return "", err
+		}
+		// The body rev must match the one we update
+		doc["_rev"] = rev
+		newRev, err := c.Update(id, Rev(rev), doc)
+		if errors.Is(err, ErrConflict) && i < c.mutateRetries() {
+			continue
+		}
+		return newRev, err
+	}
+}
+
+// Mutate is the typed variant of Couch.Mutate, decoding the document into a
+// T. T doesn't need _id and _rev fields, they are carried along separately,
+// as are any other fields of the document that T doesn't declare.
+func Mutate[T any](c *Couch, id Id, fn func(*T) error) (Rev, error) {
+	for i := 0; ; i++ {
+		doc := &revisioned[T]{}
+		if err := c.Get(id, doc); err != nil {
+			return "", err
+		}
+		if err := fn(doc.Doc); err != nil {
+			return "", err
+		}
+		newRev, err := c.Update(id, doc.Rev, doc)
+		if errors.Is(err, ErrConflict) && i < c.mutateRetries() {
+			continue
+		}
+		return newRev, err
+	}
+}
+
+// revisioned wraps a document decoded into a T with its _id and _rev. Fields
+// of the stored document that T doesn't know about are kept, so writing it
+// back doesn't drop them.
+type revisioned[T any] struct {
+	Id     Id
+	Rev    Rev
+	Doc    *T
+	fields map[string]json.RawMessage
+}
+
+func (r *revisioned[T]) UnmarshalJSON(b []byte) error {
+	var meta struct {
+		Id  Id  `json:"_id"`
+		Rev Rev `json:"_rev"`
+	}
+	if err := json.Unmarshal(b, &meta); err != nil {
+		return err
+	}
+	if err := json.Unmarshal(b, &r.fields); err != nil {
+		return err
+	}
+	r.Id, r.Rev, r.Doc = meta.Id, meta.Rev, new(T)
+	return json.Unmarshal(b, r.Doc)
+}
+
+func (r *revisioned[T]) MarshalJSON() ([]byte, error) {
+	b, err := json.Marshal(r.Doc)
+	if err != nil {
+		return nil, err
+	}
+	var m map[string]json.RawMessage
+	if err := json.Unmarshal(b, &m); err != nil {
+		return nil, fmt.Errorf("document is not a JSON object: %v", err)
+	}
+	known, all := jsonFields(reflect.TypeOf(r.Doc).Elem())
+	for k, v := range r.fields {
+		// Fields of T missing from m were left out by omitempty
+		if _, ok := m[k]; !ok && !all && !known[strings.ToLower(k)] {
+			m[k] = v
+		}
+	}
+	for k, v := range map[string]string{"_id": string(r.Id), "_rev": string(r.Rev)} {
+		if v != "" {
+			m[k], _ = json.Marshal(v)
+		}
+	}
+	return json.Marshal(m)
+}
+
+// jsonFields returns the lower cased JSON keys of the fields of struct type t,
+// matched case insensitively like encoding/json does. all is true if t isn't
+// a struct, e.g. a map, so it holds all keys itself.
+func jsonFields(t reflect.Type) (known map[string]bool, all bool) {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return nil, true
+	}
+	known = make(map[string]bool)
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name := strings.Split(tag, ",")[0]
+		ft := f.Type
+		if ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+		if f.Anonymous && name == "" && ft.Kind() == reflect.Struct {
+			// Fields of embedded structs are promoted
+			embedded, _ := jsonFields(ft)
+			for k := range embedded {
+				known[k] = true
+			}
+			continue
+		}
+		if !f.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		known[strings.ToLower(name)] = true
+	}
+	return known, false
+}
+
+// encodeQueryPairs builds a query string from key/value pairs, JSON encoding
+// each value. Parameters are sorted by key, keeping the given order for
+// repeated keys, so equal queries always produce the same string.
+func encodeQueryPairs(queryPairs []interface{}) (string, error) {
+	if len(queryPairs)%2 != 0 {
+		return "", fmt.Errorf("query pairs must be key/value pairs, got %d values", len(queryPairs))
+	}
+	type param struct{ k, v string }
+	params := make([]param, 0, len(queryPairs)/2)
+	for i := 0; i < len(queryPairs); i += 2 {
+		k, ok := queryPairs[i].(string)
+		if !ok {
+			return "", fmt.Errorf("query key %v is not a string", queryPairs[i])
+		}
+		v, err := json.Marshal(queryPairs[i+1])
+		if err != nil {
+			return "", err
+		}
+		params = append(params, param{k, string(v)})
+	}
+	sort.SliceStable(params, func(i, j int) bool { return params[i].k < params[j].k })
+	pairs := make([]string, 0, len(params))
+	for _, p := range params {
+		pairs = append(pairs, fmt.Sprintf("%s=%s", url.QueryEscape(p.k), url.QueryEscape(p.v)))
+	}
+	return strings.Join(pairs, "&"), nil
+}
+
+// Query requests the view or other index at path, relative to the database.
+// queryPairs are key/value pairs of query parameters, see the P* constants,
+// whose values are JSON encoded. The query string is sorted by key.
 func (c *Couch) Query(path string, bodyJson map[string]interface{}, queryPairs ...interface{}) (*Result, error) {
+	query, err := encodeQueryPairs(queryPairs)
+	if err != nil {
+		return nil, err
+	}
+	return c.query(context.Background(), path, bodyJson, query)
+}
+
+// query requests path with an already encoded query string.
+func (c *Couch) query(ctx context.Context, path string, bodyJson map[string]interface{}, query string) (*Result, error) {
 	var body []byte
 	if bodyJson != nil {
-		b, err := json.Marshal(bodyJson)
+		b, err := c.marshal(bodyJson)
 		if err != nil {
 			return nil, err
 		}
 		body = b
 	}
-	pairs := make([]string, 0, len(queryPairs)/2)
-	for i := 0; i < len(queryPairs)-1; i += 2 {
-		if k, ok := queryPairs[i].(string); ok {
-			v, err := json.Marshal(queryPairs[i+1])
-			if err == nil {
-				pairs = append(pairs, fmt.Sprintf("%s=%s", url.QueryEscape(k), url.QueryEscape(string(v))))
-			} else {
-				return nil, err
-			}
-		}
+	url, err := c.dbURL(path + "?" + query)
+	if err != nil {
+		return nil, err
 	}
-	query := strings.Join(pairs, "&")
-	url := c.BaseURL() + "/" + c.Db() + "/" + path + "?" + query
 	method := "GET"
 	if body != nil {
 		method = "POST"
 	}
-	resp, err := c.req(
+	c.logBody(method, url, body)
+	resp, err := c.reqBody(
+		ctx,
 		method,
 		url,
-		http.Header{"Content-Type": []string{"application/json"}},
-		body,
+		"application/json",
+		nil,
+		bytes.NewReader(body),
+		int64(len(body)),
 		c.url.User,
 	)
 	if err != nil {
 		return nil, err
 	}
-	respObj, err := verifyAndUnmarshalResponse(resp, 200)
-	if err != nil {
+	if resp.StatusCode != 200 {
+		return nil, c.couchError(resp)
+	}
+	var v queryResponse
+	if err := c.unmarshalInto(resp, 200, &v); err != nil {
 		return nil, err
 	}
-	result := &Result{}
-	if x, ok := respObj["total_rows"]; ok {
-		if y, ok := x.(float64); ok {
-			result.TotalRows = uint64(y)
-		} else {
-			return nil, fmt.Errorf("invalid total rows value")
-		}
-	} else {
+	return v.result()
+}
+
+// queryResponse is the response to a view query.
+type queryResponse struct {
+	TotalRows *uint64 `json:"total_rows"`
+	Offset    *uint64 `json:"offset"`
+	Rows      []struct {
+		Id    *Id             `json:"id"`
+		Key   interface{}     `json:"key"`
+		Value interface{}     `json:"value"`
+		Doc   json.RawMessage `json:"doc"`
+	} `json:"rows"`
+}
+
+func (v *queryResponse) result() (*Result, error) {
+	if v.TotalRows == nil {
 		return nil, fmt.Errorf("total rows not set")
 	}
-	if x, ok := respObj["offset"]; ok {
-		if y, ok := x.(float64); ok {
-			result.Offset = uint64(y)
-		} else {
-			return nil, fmt.Errorf("invalid offset value")
-		}
-	} else {
+	if v.Offset == nil {
 		return nil, fmt.Errorf("offset not set")
 	}
-	if x, ok := respObj["rows"]; ok {
-		if y, ok := x.([]interface{}); ok {
-			result.Rows = make([]*Row, 0, 50)
-			for _, rowI := range y {
-				if row, ok := rowI.(map[string]interface{}); ok {
-					if id, ok := row["id"].(string); ok {
-						result.Rows = append(result.Rows, &Row{
-							Id:    Id(id),
-							Key:   row["key"],
-							Value: row["value"],
-						})
-					}
-				}
-			}
-		} else {
-			return nil, fmt.Errorf("invalid rows value")
-		}
-	} else {
+	if v.Rows == nil {
 		return nil, fmt.Errorf("rows not set")
 	}
+	result := &Result{
+		TotalRows: *v.TotalRows,
+		Offset:    *v.Offset,
+		Rows:      make([]*Row, 0, len(v.Rows)),
+	}
+	for _, row := range v.Rows {
+		// Rows without id, like reduce results, are skipped
+		if row.Id != nil {
+			result.Rows = append(result.Rows, &Row{
+				Id:    *row.Id,
+				Key:   row.Key,
+				Value: row.Value,
+				Doc:   row.Doc,
+			})
+		}
+	}
 	return result, nil
 }
+
+// Do sends a request to path, relative to the server root, and is meant for
+// endpoints that aren't wrapped by this package yet. A non-nil body is JSON
+// encoded and params are sent as query string. On a 2xx status the response
+// is JSON decoded into out, if out is not nil, otherwise a *CouchError is
+// returned. The response status is returned in both cases.
+func (c *Couch) Do(method, path string, body interface{}, out interface{}, params url.Values) (int, error) {
+	baseURL := c.BaseURL()
+	if baseURL == "" {
+		return 0, fmt.Errorf("couch url not valid")
+	}
+	u := baseURL + "/" + strings.TrimPrefix(path, "/")
+	if len(params) > 0 {
+		u += "?" + params.Encode()
+	}
+	return c.doJSON(method, u, body, out)
+}
+
+// doJSON sends a request to the URL u. body may be any value, also a bare
+// number or array as some endpoints expect, and is JSON encoded unless nil.
+// On a 2xx status the response is decoded into out, if out is not nil,
+// otherwise a *CouchError is returned.
+func (c *Couch) doJSON(method, u string, body interface{}, out interface{}) (int, error) {
+	var b []byte
+	if body != nil {
+		var err error
+		b, err = c.marshal(body)
+		if err != nil {
+			return 0, err
+		}
+	}
+	resp, err := c.req(
+		method,
+		u,
+		http.Header{"Content-Type": []string{"application/json"}},
+		b,
+		c.url.User,
+	)
+	if err != nil {
+		return 0, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, c.couchError(resp)
+	}
+	data, err := c.readResponse(resp, resp.StatusCode)
+	if err != nil {
+		return resp.StatusCode, err
+	}
+	if out != nil && len(bytes.TrimSpace(data)) > 0 {
+		if err := c.unmarshal(data, out); err != nil {
+			return resp.StatusCode, err
+		}
+	}
+	return resp.StatusCode, nil
+}
+
+// RawRequest sends a request to path, relative to the server root, with the
+// client's credentials and returns the response as is, whatever its status.
+// The caller must close the response body.
+func (c *Couch) RawRequest(method, path string, body io.Reader, headers http.Header) (*http.Response, error) {
+	baseURL := c.BaseURL()
+	if baseURL == "" {
+		return nil, fmt.Errorf("couch url not valid")
+	}
+	size := int64(-1)
+	if body == nil {
+		size = 0
+	}
+	return c.reqBody(
+		context.Background(),
+		method,
+		baseURL+"/"+strings.TrimPrefix(path, "/"),
+		"",
+		headers,
+		body,
+		size,
+		c.url.User,
+	)
+}
+
+// Count returns the number of rows the view ddoc/view emits for key.
+//
+// If the view has a reduce function (which should be _count), Count queries
+// it with reduce=true and group=false and returns the reduced value. If the
+// view has no reduce function, CouchDB rejects the reduce query and Count
+// falls back to fetching the map rows for key and counting them.
+func (c *Couch) Count(ddoc, view string, key interface{}) (uint64, error) {
+	path := "_design/" + escapeSegment(ddoc) + "/_view/" + escapeSegment(view)
+	n, err := c.reducedCount(path, key)
+	if err != errNoReduce {
+		return n, err
+	}
+	// Fallback for map-only views
+	result, err := c.Query(path, nil, PKey, key, PReduce, false)
+	if err != nil {
+		return 0, err
+	}
+	return uint64(len(result.Rows)), nil
+}
+
+var errNoReduce = fmt.Errorf("view has no reduce function")
+
+func (c *Couch) reducedCount(path string, key interface{}) (uint64, error) {
+	query, err := encodeQueryPairs([]interface{}{PKey, key, PReduce, true, PGroup, false})
+	if err != nil {
+		return 0, err
+	}
+	u, err := c.dbURL(path + "?" + query)
+	if err != nil {
+		return 0, err
+	}
+	resp, err := c.req(
+		"GET",
+		u,
+		nil,
+		nil,
+		c.url.User,
+	)
+	if err != nil {
+		return 0, err
+	}
+	if resp.StatusCode != 200 {
+		err := c.couchError(resp)
+		// Map-only views answer reduce queries with a query_parse_error
+		if e, ok := err.(*CouchError); ok && e.StatusCode == 400 && e.Type == "query_parse_error" {
+			return 0, errNoReduce
+		}
+		return 0, err
+	}
+	v, err := c.verifyAndUnmarshalResponse(resp, 200)
+	if err != nil {
+		return 0, err
+	}
+	rows, ok := v["rows"].([]interface{})
+	if !ok {
+		return 0, fmt.Errorf("invalid rows value")
+	}
+	if len(rows) == 0 {
+		// No rows emitted for key
+		return 0, nil
+	}
+	row, ok := rows[0].(map[string]interface{})
+	if !ok {
+		return 0, fmt.Errorf("invalid row value")
+	}
+	count, ok := row["value"].(float64)
+	if !ok {
+		return 0, fmt.Errorf("reduced value is not a count")
+	}
+	return uint64(count), nil
+}
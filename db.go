@@ -0,0 +1,199 @@
+package couch
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// DbInfo describes a database.
+type DbInfo struct {
+	Name           string `json:"db_name"`
+	DocCount       uint64 `json:"doc_count"`
+	DocDelCount    uint64 `json:"doc_del_count"`
+	UpdateSeq      Seq    `json:"update_seq"`
+	PurgeSeq       Seq    `json:"purge_seq"`
+	CompactRunning bool   `json:"compact_running"`
+	DiskSize       uint64 `json:"disk_size"`
+	DataSize       uint64 `json:"data_size"`
+	Sizes          struct {
+		File     uint64 `json:"file"`
+		External uint64 `json:"external"`
+		Active   uint64 `json:"active"`
+	} `json:"sizes"`
+}
+
+// DbInfo returns information about the database. On servers that only report
+// sizes, DiskSize and DataSize are set from the file and active size.
+func (c *Couch) DbInfo() (*DbInfo, error) {
+	u, err := c.dbURL("")
+	if err != nil {
+		return nil, err
+	}
+	info := &DbInfo{}
+	if err := c.getJSON(u, info); err != nil {
+		return nil, err
+	}
+	info.setSizes()
+	return info, nil
+}
+
+// setSizes sets DiskSize and DataSize from Sizes if the server only reports
+// the latter.
+func (info *DbInfo) setSizes() {
+	if info.DiskSize == 0 {
+		info.DiskSize = info.Sizes.File
+	}
+	if info.DataSize == 0 {
+		info.DataSize = info.Sizes.Active
+	}
+}
+
+// DbsInfo returns information about the databases names in a single request,
+// on CouchDB 2.2 and later. Databases that don't exist are left out.
+func (c *Couch) DbsInfo(names []string) (map[string]*DbInfo, error) {
+	var v []struct {
+		Key   string  `json:"key"`
+		Info  *DbInfo `json:"info"`
+		Error string  `json:"error"`
+	}
+	body := map[string][]string{"keys": names}
+	if _, err := c.Do("POST", "/_dbs_info", body, &v, nil); err != nil {
+		return nil, err
+	}
+	infos := make(map[string]*DbInfo, len(v))
+	for _, db := range v {
+		if db.Info == nil {
+			continue
+		}
+		db.Info.setSizes()
+		infos[db.Key] = db.Info
+	}
+	return infos, nil
+}
+
+// Fragmentation returns the ratio of the file size to the size of the live
+// data. The higher it is the more space compaction would free, a value above
+// 2 is a common threshold to compact. Returns 0 if the data size is unknown.
+func (info *DbInfo) Fragmentation() float64 {
+	if info.DataSize == 0 {
+		return 0
+	}
+	return float64(info.DiskSize) / float64(info.DataSize)
+}
+
+// DiskUsage returns the size of the live data in the database and the size
+// of its file, see DbInfo.
+func (c *Couch) DiskUsage() (dataSize, diskSize uint64, err error) {
+	info, err := c.DbInfo()
+	if err != nil {
+		return 0, 0, err
+	}
+	return info.DataSize, info.DiskSize, nil
+}
+
+// Purge permanently removes the given revisions of documents and returns the
+// revisions that were purged.
+func (c *Couch) Purge(docs map[Id][]Rev) (map[Id][]Rev, error) {
+	u, err := c.dbURL("_purge")
+	if err != nil {
+		return nil, err
+	}
+	var v struct {
+		Purged map[Id][]Rev `json:"purged"`
+	}
+	if _, err := c.doJSON("POST", u, docs, &v); err != nil {
+		return nil, err
+	}
+	return v.Purged, nil
+}
+
+// PurgeAndWait purges the given revisions and blocks until the purge_seq of
+// the database has moved on or ctx is done. This only shows that the purge
+// was recorded: in a cluster purges are applied to shard copies and indexes
+// asynchronously, so reads may still return the purged revisions for a
+// while. Only the last purged_infos_limit purges are kept per database, so
+// purging more documents at once than that is rejected, since replicas would
+// miss the older ones.
+func (c *Couch) PurgeAndWait(ctx context.Context, docs map[Id][]Rev) error {
+	limit, err := c.GetPurgedInfosLimit()
+	if err != nil {
+		return err
+	}
+	if len(docs) > limit {
+		return fmt.Errorf("purging %d documents exceeds the purged_infos_limit of %d", len(docs), limit)
+	}
+	before, err := c.DbInfo()
+	if err != nil {
+		return err
+	}
+	purged, err := c.Purge(docs)
+	if err != nil {
+		return err
+	}
+	if len(purged) == 0 {
+		return nil
+	}
+	for {
+		info, err := c.DbInfo()
+		if err != nil {
+			return err
+		}
+		if info.PurgeSeq != before.PurgeSeq {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(pollInterval):
+		}
+	}
+}
+
+// GetRevsLimit returns how many revisions of each document the database keeps
+// track of.
+func (c *Couch) GetRevsLimit() (int, error) {
+	return c.getLimit("_revs_limit")
+}
+
+// SetRevsLimit sets how many revisions of each document the database keeps
+// track of. Lowering it saves space for frequently updated documents, but
+// makes conflicts harder to resolve after replicas diverged for a long time.
+func (c *Couch) SetRevsLimit(n int) error {
+	return c.setLimit("_revs_limit", n)
+}
+
+// GetPurgedInfosLimit returns how many purges the database remembers.
+func (c *Couch) GetPurgedInfosLimit() (int, error) {
+	return c.getLimit("_purged_infos_limit")
+}
+
+// SetPurgedInfosLimit sets how many purges the database remembers, to limit
+// the space taken by purge history. Replicas and indexes that fall further
+// behind miss the older purges.
+func (c *Couch) SetPurgedInfosLimit(n int) error {
+	return c.setLimit("_purged_infos_limit", n)
+}
+
+// getLimit reads a database setting whose value is a bare integer.
+func (c *Couch) getLimit(path string) (int, error) {
+	u, err := c.dbURL(path)
+	if err != nil {
+		return 0, err
+	}
+	var n int
+	if err := c.getJSON(u, &n); err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+// setLimit stores a database setting whose value is a bare integer.
+func (c *Couch) setLimit(path string, n int) error {
+	u, err := c.dbURL(path)
+	if err != nil {
+		return err
+	}
+	_, err = c.doJSON("PUT", u, n, nil)
+	return err
+}
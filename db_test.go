@@ -0,0 +1,166 @@
+package couch
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestDbInfo(t *testing.T) {
+	couch, srv := newTestCouch(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/mydb" {
+			t.Error("invalid path", r.URL.Path)
+		}
+		w.Write([]byte("{\"db_name\":\"mydb\",\"doc_count\":3,\"update_seq\":\"5-g1AAAA\",\"purge_seq\":0,\"sizes\":{\"file\":4096,\"external\":100,\"active\":1024}}"))
+	})
+	defer srv.Close()
+	info, err := couch.DbInfo()
+	if err != nil {
+		t.Fatal("error not nil", err)
+	}
+	if info.Name != "mydb" || info.DocCount != 3 || info.UpdateSeq != "5-g1AAAA" || info.PurgeSeq != "0" || info.DiskSize != 4096 || info.DataSize != 1024 {
+		t.Fatal("invalid info", info)
+	}
+	if f := info.Fragmentation(); f != 4 {
+		t.Fatal("invalid fragmentation", f)
+	}
+	data, disk, err := couch.DiskUsage()
+	if err != nil {
+		t.Fatal("error not nil", err)
+	}
+	if data != 1024 || disk != 4096 {
+		t.Fatal("invalid disk usage", data, disk)
+	}
+	if f := (&DbInfo{DiskSize: 10}).Fragmentation(); f != 0 {
+		t.Fatal("invalid fragmentation", f)
+	}
+}
+
+func TestDbsInfo(t *testing.T) {
+	couch, srv := newTestCouch(t, func(w http.ResponseWriter, r *http.Request) {
+		var v struct {
+			Keys []string `json:"keys"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&v); err != nil {
+			t.Error("invalid body", err)
+		}
+		if r.Method != "POST" || r.URL.Path != "/_dbs_info" || len(v.Keys) != 2 {
+			t.Error("invalid request", r.Method, r.URL.Path, v)
+		}
+		w.Write([]byte("[{\"key\":\"a\",\"info\":{\"db_name\":\"a\",\"doc_count\":3,\"sizes\":{\"file\":4096,\"active\":1024}}}," +
+			"{\"key\":\"missing\",\"error\":\"not_found\"}]"))
+	})
+	defer srv.Close()
+	infos, err := couch.DbsInfo([]string{"a", "missing"})
+	if err != nil {
+		t.Fatal("error not nil", err)
+	}
+	if len(infos) != 1 || infos["a"].DocCount != 3 || infos["a"].DiskSize != 4096 || infos["a"].DataSize != 1024 {
+		t.Fatal("invalid infos", infos)
+	}
+}
+
+func TestPurgeAndWait(t *testing.T) {
+	defer func(d time.Duration) { pollInterval = d }(pollInterval)
+	pollInterval = time.Millisecond
+	var polls int32
+	limit := "1000"
+	couch, srv := newTestCouch(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/mydb/_purged_infos_limit":
+			w.Write([]byte(limit + "\n"))
+		case "/mydb":
+			seq := "\"0-abc\""
+			if atomic.AddInt32(&polls, 1) >= 4 {
+				seq = "\"1-def\""
+			}
+			w.Write([]byte("{\"db_name\":\"mydb\",\"purge_seq\":" + seq + "}"))
+		case "/mydb/_purge":
+			if r.Method != "POST" {
+				t.Error("invalid method", r.Method)
+			}
+			var docs map[Id][]Rev
+			if err := json.NewDecoder(r.Body).Decode(&docs); err != nil {
+				t.Error("invalid body", err)
+			}
+			if len(docs["a"]) != 1 || docs["a"][0] != "1-x" {
+				t.Error("invalid docs", docs)
+			}
+			w.WriteHeader(201)
+			w.Write([]byte("{\"purge_seq\":null,\"purged\":{\"a\":[\"1-x\"]}}"))
+		default:
+			t.Error("invalid path", r.URL.Path)
+		}
+	})
+	defer srv.Close()
+	if err := couch.PurgeAndWait(context.Background(), map[Id][]Rev{"a": {"1-x"}}); err != nil {
+		t.Fatal("error not nil", err)
+	}
+	if atomic.LoadInt32(&polls) != 4 {
+		t.Fatal("expected 4 info requests", polls)
+	}
+	atomic.StoreInt32(&polls, -100)
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := couch.PurgeAndWait(ctx, map[Id][]Rev{"a": {"1-x"}}); err != context.DeadlineExceeded {
+		t.Fatal("expected deadline exceeded", err)
+	}
+	limit = "1"
+	atomic.StoreInt32(&polls, 0)
+	if err := couch.PurgeAndWait(context.Background(), map[Id][]Rev{"a": {"1-x"}, "b": {"1-y"}}); err == nil {
+		t.Fatal("expected limit error")
+	}
+	if atomic.LoadInt32(&polls) != 0 {
+		t.Fatal("purged beyond the limit", polls)
+	}
+}
+
+func TestLimits(t *testing.T) {
+	limits := map[string]string{"/mydb/_revs_limit": "1000", "/mydb/_purged_infos_limit": "1000"}
+	couch, srv := newTestCouch(t, func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := limits[r.URL.Path]; !ok {
+			t.Error("invalid path", r.URL.Path)
+		}
+		switch r.Method {
+		case "GET":
+			w.Write([]byte(limits[r.URL.Path] + "\n"))
+		case "PUT":
+			b, _ := ioutil.ReadAll(r.Body)
+			if _, err := strconv.Atoi(string(b)); err != nil {
+				w.WriteHeader(400)
+				w.Write([]byte("{\"error\":\"bad_request\",\"reason\":\"invalid body\"}"))
+				return
+			}
+			limits[r.URL.Path] = string(b)
+			w.Write([]byte("{\"ok\":true}"))
+		}
+	})
+	defer srv.Close()
+	n, err := couch.GetRevsLimit()
+	if err != nil {
+		t.Fatal("error not nil", err)
+	}
+	if n != 1000 {
+		t.Fatal("expected 1000", n)
+	}
+	if err = couch.SetRevsLimit(50); err != nil {
+		t.Fatal("error not nil", err)
+	}
+	if n, _ = couch.GetRevsLimit(); n != 50 {
+		t.Fatal("expected 50", n)
+	}
+	if err = couch.SetPurgedInfosLimit(200); err != nil {
+		t.Fatal("error not nil", err)
+	}
+	if n, err = couch.GetPurgedInfosLimit(); err != nil || n != 200 {
+		t.Fatal("expected 200", n, err)
+	}
+	if limits["/mydb/_revs_limit"] != "50" {
+		t.Fatal("revs limit changed", limits)
+	}
+}
@@ -0,0 +1,199 @@
+package couch
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+)
+
+// View is the definition of a view in a design document.
+type View struct {
+	Map    string `json:"map"`
+	Reduce string `json:"reduce,omitempty"`
+}
+
+// DesignDoc builds a design document defining views. The embedded Document
+// holds the revision, which PutDesignDoc keeps current.
+type DesignDoc struct {
+	Document
+	Language string           `json:"language,omitempty"`
+	Views    map[string]*View `json:"views,omitempty"`
+}
+
+// AddView adds or replaces view name. reduceFn may be empty for map-only
+// views.
+func (d *DesignDoc) AddView(name, mapFn, reduceFn string) *DesignDoc {
+	if d.Views == nil {
+		d.Views = make(map[string]*View)
+	}
+	d.Views[name] = &View{Map: mapFn, Reduce: reduceFn}
+	return d
+}
+
+// SetLanguage sets the language of the view functions. CouchDB defaults to
+// javascript.
+func (d *DesignDoc) SetLanguage(language string) *DesignDoc {
+	d.Language = language
+	return d
+}
+
+// Marshal returns the JSON of the design document.
+func (d *DesignDoc) Marshal() ([]byte, error) {
+	return json.Marshal(d)
+}
+
+// PutDesignDoc stores ddoc as design document _design/name. To update an
+// existing design document, ddoc must carry its current revision.
+func (c *Couch) PutDesignDoc(name string, ddoc *DesignDoc) (Rev, error) {
+	return c.Update(Id("_design/"+name), "", ddoc)
+}
+
+// DeployDesignDoc stores ddoc as design document _design/name unless the
+// stored one has the same content, which avoids rebuilding its views. The
+// revision and id aren't compared. ddoc may be a *DesignDoc or any value
+// encoding to a design document. Returns whether ddoc was written and the
+// current revision.
+func (c *Couch) DeployDesignDoc(name string, ddoc interface{}) (changed bool, rev Rev, err error) {
+	id := Id("_design/" + name)
+	var current map[string]interface{}
+	if err := c.Get(id, &current); err != nil && !errors.Is(err, ErrNotFound) {
+		return false, "", err
+	}
+	if current != nil {
+		s, _ := current["_rev"].(string)
+		rev = Rev(s)
+		b, err := c.marshalDoc(ddoc)
+		if err != nil {
+			return false, "", err
+		}
+		var next map[string]interface{}
+		if err := c.unmarshal(b, &next); err != nil {
+			return false, "", err
+		}
+		for _, k := range []string{"_id", "_rev"} {
+			delete(current, k)
+			delete(next, k)
+		}
+		if reflect.DeepEqual(current, next) {
+			return false, rev, nil
+		}
+	}
+	setRev(ddoc, rev)
+	if rev, err = c.Update(id, rev, ddoc); err != nil {
+		return false, "", err
+	}
+	return true, rev, nil
+}
+
+// DesignDocs returns the ids of all design documents in the database, with
+// the _design/ prefix, on CouchDB 2.0 and later.
+func (c *Couch) DesignDocs() ([]Id, error) {
+	result, err := c.Query("_design_docs", nil)
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]Id, 0, len(result.Rows))
+	for _, row := range result.Rows {
+		ids = append(ids, row.Id)
+	}
+	return ids, nil
+}
+
+// HasReduce reports whether view of design document ddoc has a reduce
+// function, so queries of its rows need reduce=false.
+func (c *Couch) HasReduce(ddoc, view string) (bool, error) {
+	var d DesignDoc
+	if err := c.Get(Id("_design/"+ddoc), &d); err != nil {
+		return false, err
+	}
+	v, ok := d.Views[view]
+	if !ok || v == nil {
+		return false, fmt.Errorf("view %q not found in design document %q", view, ddoc)
+	}
+	return v.Reduce != "", nil
+}
+
+// Show runs the show function name of design document ddoc on document docId
+// and returns the response body and its content type. An empty docId runs the
+// function without a document.
+func (c *Couch) Show(ddoc, name string, docId Id) ([]byte, string, error) {
+	u, err := c.docURL(Id("_design/" + ddoc))
+	if err != nil {
+		return nil, "", err
+	}
+	u += "/_show/" + escapeSegment(name)
+	if docId != "" {
+		u += "/" + escapeSegment(string(docId))
+	}
+	return c.getRaw(u)
+}
+
+// List runs the list function name of design document ddoc on the rows of
+// view, queried with opts, and returns the response body and its content
+// type.
+func (c *Couch) List(ddoc, name, view string, opts ViewOptions) ([]byte, string, error) {
+	u, err := c.docURL(Id("_design/" + ddoc))
+	if err != nil {
+		return nil, "", err
+	}
+	v, err := opts.values()
+	if err != nil {
+		return nil, "", err
+	}
+	u += "/_list/" + escapeSegment(name) + "/" + escapeSegment(view)
+	if len(v) > 0 {
+		u += "?" + v.Encode()
+	}
+	return c.getRaw(u)
+}
+
+// getRaw requests u and returns the response body as is, with its content
+// type.
+func (c *Couch) getRaw(u string) ([]byte, string, error) {
+	resp, body, err := c.fetch("GET", u, nil, false)
+	if err != nil {
+		return nil, "", err
+	}
+	return body, resp.Header.Get("Content-Type"), nil
+}
+
+// UpdateHandler invokes the update function name of design document ddoc on
+// document docId, or without a document if docId is empty. A non-nil body is
+// JSON encoded. Returns the response body of the function and the new
+// revision of the document, which is empty if the function didn't store one.
+func (c *Couch) UpdateHandler(ddoc, name string, docId Id, body interface{}) ([]byte, Rev, error) {
+	u, err := c.docURL(Id("_design/" + ddoc))
+	if err != nil {
+		return nil, "", err
+	}
+	u += "/_update/" + escapeSegment(name)
+	if docId != "" {
+		u += "/" + escapeSegment(string(docId))
+	}
+	var b []byte
+	if body != nil {
+		if b, err = c.marshal(body); err != nil {
+			return nil, "", err
+		}
+	}
+	resp, err := c.req(
+		"POST",
+		u,
+		http.Header{"Content-Type": []string{"application/json"}},
+		b,
+		c.url.User,
+	)
+	if err != nil {
+		return nil, "", err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, "", c.couchError(resp)
+	}
+	data, err := c.readResponse(resp, resp.StatusCode)
+	if err != nil {
+		return nil, "", err
+	}
+	return data, Rev(resp.Header.Get("X-Couch-Update-NewRev")), nil
+}
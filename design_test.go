@@ -0,0 +1,210 @@
+package couch
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"testing"
+)
+
+func TestDesignDoc(t *testing.T) {
+	ddoc := &DesignDoc{}
+	ddoc.SetLanguage("javascript").
+		AddView("by_customer", "function(doc) { emit(doc.customer, null); }", "_count").
+		AddView("by_date", "function(doc) { emit(doc.date, null); }", "")
+	b, err := ddoc.Marshal()
+	if err != nil {
+		t.Fatal("error not nil", err)
+	}
+	expect := "{\"language\":\"javascript\",\"views\":{" +
+		"\"by_customer\":{\"map\":\"function(doc) { emit(doc.customer, null); }\",\"reduce\":\"_count\"}," +
+		"\"by_date\":{\"map\":\"function(doc) { emit(doc.date, null); }\"}}}"
+	if string(b) != expect {
+		t.Fatal("not equal", string(b), expect)
+	}
+}
+
+func TestPutDesignDoc(t *testing.T) {
+	store := newDocStore()
+	couch, srv := newTestCouch(t, store.ServeHTTP)
+	defer srv.Close()
+	ddoc := (&DesignDoc{}).AddView("by_customer", "function(doc) { emit(doc.customer, null); }", "_count")
+	rev, err := couch.PutDesignDoc("orders", ddoc)
+	if err != nil {
+		t.Fatal("error not nil", err)
+	}
+	if rev != "1-1" || ddoc.Rev != rev || ddoc.Id != "_design/orders" {
+		t.Fatal("invalid rev", rev, ddoc.Document)
+	}
+	ddoc.AddView("by_date", "function(doc) { emit(doc.date, null); }", "")
+	if rev, err = couch.PutDesignDoc("orders", ddoc); err != nil {
+		t.Fatal("error not nil", err)
+	}
+	views, ok := store.docs["_design/orders"]["views"].(map[string]interface{})
+	if !ok || len(views) != 2 || rev != "2-2" {
+		t.Fatal("invalid design doc", store.docs["_design/orders"])
+	}
+}
+
+func TestDeployDesignDoc(t *testing.T) {
+	store := newDocStore()
+	couch, srv := newTestCouch(t, store.ServeHTTP)
+	defer srv.Close()
+	build := func() *DesignDoc {
+		return (&DesignDoc{}).AddView("by_customer", "function(doc) { emit(doc.customer, null); }", "_count")
+	}
+	changed, rev, err := couch.DeployDesignDoc("orders", build())
+	if err != nil {
+		t.Fatal("error not nil", err)
+	}
+	if !changed || rev != "1-1" {
+		t.Fatal("expected deploy", changed, rev)
+	}
+	changed, rev, err = couch.DeployDesignDoc("orders", build())
+	if err != nil {
+		t.Fatal("error not nil", err)
+	}
+	if changed || rev != "1-1" || store.puts != 1 {
+		t.Fatal("expected no deploy", changed, rev, store.puts)
+	}
+	ddoc := map[string]interface{}{
+		"_rev": "0-stale",
+		"views": map[string]interface{}{
+			"by_customer": map[string]interface{}{"map": "function(doc) { emit(doc.customer, 1); }"},
+		},
+	}
+	changed, rev, err = couch.DeployDesignDoc("orders", ddoc)
+	if err != nil {
+		t.Fatal("error not nil", err)
+	}
+	if !changed || rev != "2-2" || store.puts != 2 {
+		t.Fatal("expected deploy", changed, rev, store.puts)
+	}
+}
+
+func TestDesignDocs(t *testing.T) {
+	couch, srv := newTestCouch(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/mydb/_design_docs" {
+			t.Error("invalid path", r.URL.Path)
+		}
+		w.Write([]byte("{\"total_rows\":2,\"offset\":0,\"rows\":[" +
+			"{\"id\":\"_design/orders\",\"key\":\"_design/orders\",\"value\":{\"rev\":\"2-a\"}}," +
+			"{\"id\":\"_design/users\",\"key\":\"_design/users\",\"value\":{\"rev\":\"1-b\"}}]}"))
+	})
+	defer srv.Close()
+	ids, err := couch.DesignDocs()
+	if err != nil {
+		t.Fatal("error not nil", err)
+	}
+	if len(ids) != 2 || ids[0] != "_design/orders" || ids[1] != "_design/users" {
+		t.Fatal("invalid ids", ids)
+	}
+}
+
+func TestHasReduce(t *testing.T) {
+	store := newDocStore()
+	couch, srv := newTestCouch(t, store.ServeHTTP)
+	defer srv.Close()
+	if _, err := couch.HasReduce("orders", "by_customer"); !errors.Is(err, ErrNotFound) {
+		t.Fatal("expected not found", err)
+	}
+	ddoc := (&DesignDoc{}).
+		AddView("by_customer", "function(doc) { emit(doc.customer, null); }", "_count").
+		AddView("by_date", "function(doc) { emit(doc.date, null); }", "")
+	if _, err := couch.PutDesignDoc("orders", ddoc); err != nil {
+		t.Fatal("error not nil", err)
+	}
+	if ok, err := couch.HasReduce("orders", "by_customer"); err != nil || !ok {
+		t.Fatal("expected reduce", ok, err)
+	}
+	if ok, err := couch.HasReduce("orders", "by_date"); err != nil || ok {
+		t.Fatal("expected no reduce", ok, err)
+	}
+	if _, err := couch.HasReduce("orders", "missing"); err == nil {
+		t.Fatal("error nil")
+	}
+}
+
+func TestShowAndList(t *testing.T) {
+	couch, srv := newTestCouch(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.EscapedPath() {
+		case "/mydb/_design/app/_show/order/a%2Fb":
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			w.Write([]byte("<h1>a/b</h1>"))
+		case "/mydb/_design/app/_show/empty":
+			w.Header().Set("Content-Type", "text/plain")
+			w.Write([]byte("no doc"))
+		case "/mydb/_design/app/_list/csv/by_date":
+			if r.URL.Query().Get("limit") != "2" || r.URL.Query().Get("startkey") != "\"2024\"" {
+				t.Error("invalid query", r.URL.RawQuery)
+			}
+			w.Header().Set("Content-Type", "text/csv")
+			w.Write([]byte("a,1\nb,2\n"))
+		default:
+			w.WriteHeader(404)
+			w.Write([]byte("{\"error\":\"not_found\",\"reason\":\"missing show function\"}"))
+		}
+	})
+	defer srv.Close()
+	body, contentType, err := couch.Show("app", "order", "a/b")
+	if err != nil {
+		t.Fatal("error not nil", err)
+	}
+	if string(body) != "<h1>a/b</h1>" || contentType != "text/html; charset=utf-8" {
+		t.Fatal("invalid response", string(body), contentType)
+	}
+	if body, _, err = couch.Show("app", "empty", ""); err != nil || string(body) != "no doc" {
+		t.Fatal("invalid response", string(body), err)
+	}
+	body, contentType, err = couch.List("app", "csv", "by_date", ViewOptions{StartKey: "2024", Limit: 2})
+	if err != nil {
+		t.Fatal("error not nil", err)
+	}
+	if string(body) != "a,1\nb,2\n" || contentType != "text/csv" {
+		t.Fatal("invalid response", string(body), contentType)
+	}
+	if _, _, err = couch.Show("app", "missing", "a"); !errors.Is(err, ErrNotFound) {
+		t.Fatal("expected not found", err)
+	}
+}
+
+func TestUpdateHandler(t *testing.T) {
+	couch, srv := newTestCouch(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" {
+			t.Error("invalid method", r.Method)
+		}
+		switch r.URL.Path {
+		case "/mydb/_design/app/_update/increment/counter":
+			b, _ := ioutil.ReadAll(r.Body)
+			if string(b) != "{\"by\":2}" {
+				t.Error("invalid body", string(b))
+			}
+			w.Header().Set("X-Couch-Update-NewRev", "4-abc")
+			w.WriteHeader(201)
+			w.Write([]byte("6"))
+		case "/mydb/_design/app/_update/noop":
+			w.Write([]byte("nothing stored"))
+		default:
+			w.WriteHeader(500)
+			w.Write([]byte("{\"error\":\"render_error\",\"reason\":\"function raised error\"}"))
+		}
+	})
+	defer srv.Close()
+	body, rev, err := couch.UpdateHandler("app", "increment", "counter", map[string]int{"by": 2})
+	if err != nil {
+		t.Fatal("error not nil", err)
+	}
+	if string(body) != "6" || rev != "4-abc" {
+		t.Fatal("invalid response", string(body), rev)
+	}
+	body, rev, err = couch.UpdateHandler("app", "noop", "", nil)
+	if err != nil {
+		t.Fatal("error not nil", err)
+	}
+	if string(body) != "nothing stored" || rev != "" {
+		t.Fatal("invalid response", string(body), rev)
+	}
+	if _, _, err = couch.UpdateHandler("app", "broken", "a", nil); err == nil {
+		t.Fatal("error nil")
+	}
+}
@@ -0,0 +1,234 @@
+package couch
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// allDocsRow is a row of _all_docs read by streamAllDocs.
+type allDocsRow struct {
+	Id    Id `json:"id"`
+	Value struct {
+		Rev Rev `json:"rev"`
+	} `json:"value"`
+	Doc json.RawMessage `json:"doc"`
+}
+
+// streamAllDocs requests _all_docs with the given query and calls fn for each
+// row as it is read, so the response is never held in memory as a whole.
+func (c *Couch) streamAllDocs(query string, fn func(row *allDocsRow) error) error {
+	u, err := c.dbURL("_all_docs?" + query)
+	if err != nil {
+		return err
+	}
+	resp, _, err := c.fetch("GET", u, nil, true)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	dec := json.NewDecoder(resp.Body)
+	if err := expectDelim(dec, '{'); err != nil {
+		return err
+	}
+	for dec.More() {
+		t, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		if t != "rows" {
+			var skip json.RawMessage
+			if err := dec.Decode(&skip); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := expectDelim(dec, '['); err != nil {
+			return err
+		}
+		for dec.More() {
+			row := &allDocsRow{}
+			if err := dec.Decode(row); err != nil {
+				return err
+			}
+			if err := fn(row); err != nil {
+				return err
+			}
+		}
+		if err := expectDelim(dec, ']'); err != nil {
+			return err
+		}
+	}
+	return expectDelim(dec, '}')
+}
+
+func expectDelim(dec *json.Decoder, delim json.Delim) error {
+	t, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	if t != delim {
+		return fmt.Errorf("expected %v in response, got %v", delim, t)
+	}
+	return nil
+}
+
+// Dump writes all documents of the database to w, including design documents,
+// as newline delimited JSON with one document per line. The documents are
+// streamed, so the database doesn't need to fit into memory. Attachments are
+// only included as stubs.
+func (c *Couch) Dump(w io.Writer) error {
+	var line bytes.Buffer
+	return c.streamAllDocs(PIncludeDocs+"=true", func(row *allDocsRow) error {
+		if row.Doc == nil {
+			return nil
+		}
+		line.Reset()
+		if err := json.Compact(&line, row.Doc); err != nil {
+			return err
+		}
+		line.WriteByte('\n')
+		_, err := w.Write(line.Bytes())
+		return err
+	})
+}
+
+// Restore writes the documents read from r, as written by Dump, to the
+// database and returns how many were restored. Documents with a _rev are
+// stored with that revision, so a restored database replicates with the
+// original one. Attachment stubs can't be restored without the attachment
+// bodies, so they are dropped, which is logged to the Logger, if any.
+func (c *Couch) Restore(r io.Reader) (int, error) {
+	batchSize := c.RestoreBatchSize
+	if batchSize < 1 {
+		batchSize = 100
+	}
+	dec := json.NewDecoder(r)
+	restored, failed := 0, 0
+	var firstFailure BulkResult
+	var withRev, withoutRev []interface{}
+	flush := func() error {
+		for _, batch := range []struct {
+			docs     []interface{}
+			newEdits bool
+		}{{withRev, false}, {withoutRev, true}} {
+			if len(batch.docs) == 0 {
+				continue
+			}
+			results, err := c.bulkDocs(batch.docs, batch.newEdits)
+			if err != nil {
+				return err
+			}
+			n := 0
+			for _, result := range results {
+				if result.Error != "" {
+					if failed == 0 {
+						firstFailure = result
+					}
+					failed++
+					n++
+				}
+			}
+			restored += len(batch.docs) - n
+		}
+		withRev, withoutRev = withRev[:0], withoutRev[:0]
+		return nil
+	}
+	for {
+		var doc map[string]json.RawMessage
+		if err := dec.Decode(&doc); err == io.EOF {
+			break
+		} else if err != nil {
+			return restored, err
+		}
+		if _, ok := doc["_attachments"]; ok {
+			delete(doc, "_attachments")
+			if c.Logger != nil {
+				c.Logger.Printf("restoring %s without attachments", doc["_id"])
+			}
+		}
+		if _, ok := doc["_rev"]; ok {
+			withRev = append(withRev, doc)
+		} else {
+			withoutRev = append(withoutRev, doc)
+		}
+		if len(withRev)+len(withoutRev) >= batchSize {
+			if err := flush(); err != nil {
+				return restored, err
+			}
+		}
+	}
+	if err := flush(); err != nil {
+		return restored, err
+	}
+	if failed > 0 {
+		return restored, fmt.Errorf("%d documents not restored, %s: %s (%s)", failed, firstFailure.Id, firstFailure.Error, firstFailure.Reason)
+	}
+	return restored, nil
+}
+
+// Diff compares the documents of the databases a and b, e.g. to verify a
+// replication, and returns the ids of the documents that are missing in
+// either. A document whose current revisions differ is reported in both
+// lists. The _all_docs of both databases are streamed and merged, so neither
+// needs to fit into memory.
+func Diff(a, b *Couch) (missingInB []Id, missingInA []Id, err error) {
+	done := make(chan struct{})
+	defer close(done)
+	rowsA, errA := a.allDocsRows(done)
+	rowsB, errB := b.allDocsRows(done)
+	ra, okA := <-rowsA
+	rb, okB := <-rowsB
+	for okA || okB {
+		switch {
+		case !okB || okA && ra.Id < rb.Id:
+			missingInB = append(missingInB, ra.Id)
+			ra, okA = <-rowsA
+		case !okA || rb.Id < ra.Id:
+			missingInA = append(missingInA, rb.Id)
+			rb, okB = <-rowsB
+		default:
+			if ra.Value.Rev != rb.Value.Rev {
+				missingInB = append(missingInB, ra.Id)
+				missingInA = append(missingInA, rb.Id)
+			}
+			ra, okA = <-rowsA
+			rb, okB = <-rowsB
+		}
+	}
+	// The row channels are also closed early on errors
+	if err := <-errA; err != nil {
+		return nil, nil, err
+	}
+	if err := <-errB; err != nil {
+		return nil, nil, err
+	}
+	return missingInB, missingInA, nil
+}
+
+var errStopped = fmt.Errorf("stopped")
+
+// allDocsRows streams the rows of _all_docs, sorted by id, to the returned
+// channel until done is closed. The channel is closed at the end, and the
+// error channel then receives the error of the request, if any.
+func (c *Couch) allDocsRows(done <-chan struct{}) (<-chan *allDocsRow, <-chan error) {
+	rows := make(chan *allDocsRow)
+	errc := make(chan error, 1)
+	go func() {
+		defer close(rows)
+		err := c.streamAllDocs("", func(row *allDocsRow) error {
+			select {
+			case rows <- row:
+				return nil
+			case <-done:
+				return errStopped
+			}
+		})
+		if err == errStopped {
+			err = nil
+		}
+		errc <- err
+	}()
+	return rows, errc
+}
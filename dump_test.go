@@ -0,0 +1,152 @@
+package couch
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestDump(t *testing.T) {
+	couch, srv := newTestCouch(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/mydb/_all_docs" || r.URL.Query().Get("include_docs") != "true" {
+			t.Error("invalid request", r.URL)
+		}
+		w.Write([]byte("{\"total_rows\":2,\"offset\":0,\"rows\":[\r\n" +
+			"{\"id\":\"_design/app\",\"key\":\"_design/app\",\"value\":{\"rev\":\"1-a\"},\"doc\":{\"_id\":\"_design/app\",\"_rev\":\"1-a\",\"views\":{}}},\r\n" +
+			"{\"id\":\"b\",\"key\":\"b\",\"value\":{\"rev\":\"2-b\"},\"doc\":{\"_id\":\"b\",\"_rev\":\"2-b\",\n\"x\": [1, 2]}}\r\n" +
+			"],\"update_seq\":\"5-x\"}"))
+	})
+	defer srv.Close()
+	var buf bytes.Buffer
+	if err := couch.Dump(&buf); err != nil {
+		t.Fatal("error not nil", err)
+	}
+	expected := "{\"_id\":\"_design/app\",\"_rev\":\"1-a\",\"views\":{}}\n{\"_id\":\"b\",\"_rev\":\"2-b\",\"x\":[1,2]}\n"
+	if buf.String() != expected {
+		t.Fatal("invalid dump", buf.String())
+	}
+}
+
+func TestDumpInvalidResponse(t *testing.T) {
+	couch, srv := newTestCouch(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("{\"total_rows\":2,\"rows\":[{\"id\":\"a\",\"doc\":{}}"))
+	})
+	defer srv.Close()
+	var buf bytes.Buffer
+	if err := couch.Dump(&buf); err == nil {
+		t.Fatal("error nil")
+	}
+	if buf.String() != "{}\n" {
+		t.Fatal("invalid dump", buf.String())
+	}
+}
+
+func TestRestore(t *testing.T) {
+	var batches []string
+	couch, srv := newTestCouch(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" || r.URL.Path != "/mydb/_bulk_docs" {
+			t.Error("invalid request", r.Method, r.URL.Path)
+		}
+		var v struct {
+			Docs     []map[string]interface{} `json:"docs"`
+			NewEdits *bool                    `json:"new_edits"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&v); err != nil {
+			t.Error("invalid body", err)
+		}
+		var ids []string
+		for _, doc := range v.Docs {
+			if _, ok := doc["_attachments"]; ok {
+				t.Error("attachment stubs sent", doc)
+			}
+			_, hasRev := doc["_rev"]
+			if hasRev != (v.NewEdits != nil && !*v.NewEdits) {
+				t.Error("invalid new_edits", doc, v.NewEdits)
+			}
+			ids = append(ids, doc["_id"].(string))
+		}
+		batches = append(batches, strings.Join(ids, ","))
+		w.WriteHeader(201)
+		if v.NewEdits != nil {
+			if ids[len(ids)-1] == "d" {
+				w.Write([]byte("[{\"id\":\"d\",\"error\":\"forbidden\",\"reason\":\"invalid doc\"}]"))
+				return
+			}
+			w.Write([]byte("[]"))
+			return
+		}
+		w.Write([]byte("[{\"ok\":true,\"id\":\"" + ids[0] + "\",\"rev\":\"1-x\"}]"))
+	})
+	defer srv.Close()
+	couch.RestoreBatchSize = 2
+	var logged bytes.Buffer
+	couch.Logger = log.New(&logged, "", 0)
+	dump := "{\"_id\":\"a\",\"_rev\":\"1-a\"}\n" +
+		"{\"_id\":\"b\",\"x\":1}\n" +
+		"{\"_id\":\"c\",\"_rev\":\"3-c\",\"_attachments\":{\"a.txt\":{\"stub\":true}}}\n" +
+		"{\"_id\":\"d\",\"_rev\":\"1-d\"}\n"
+	n, err := couch.Restore(strings.NewReader(dump))
+	if err == nil {
+		t.Fatal("error nil")
+	}
+	if n != 3 {
+		t.Fatal("expected 3 restored", n)
+	}
+	if strings.Join(batches, " ") != "a b c,d" {
+		t.Fatal("invalid batches", batches)
+	}
+	if !strings.Contains(logged.String(), "\nrestoring \"c\" without attachments\n") {
+		t.Fatal("invalid log", logged.String())
+	}
+	if n, err = couch.Restore(strings.NewReader("{\"_id\":\"e\"}{\"_id\"")); err == nil || n != 0 {
+		t.Fatal("expected decode error", n, err)
+	}
+}
+
+func TestDiff(t *testing.T) {
+	allDocs := func(rows string) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path != "/mydb/_all_docs" {
+				t.Error("invalid path", r.URL.Path)
+			}
+			if rows == "" {
+				w.WriteHeader(500)
+				w.Write([]byte("{\"error\":\"unknown_error\",\"reason\":\"boom\"}"))
+				return
+			}
+			w.Write([]byte("{\"total_rows\":3,\"offset\":0,\"rows\":[" + rows + "]}"))
+		}
+	}
+	a, srvA := newTestCouch(t, allDocs(
+		"{\"id\":\"a\",\"key\":\"a\",\"value\":{\"rev\":\"1-a\"}},"+
+			"{\"id\":\"b\",\"key\":\"b\",\"value\":{\"rev\":\"2-b\"}},"+
+			"{\"id\":\"d\",\"key\":\"d\",\"value\":{\"rev\":\"1-d\"}},"+
+			"{\"id\":\"f\",\"key\":\"f\",\"value\":{\"rev\":\"1-f\"}}"))
+	defer srvA.Close()
+	b, srvB := newTestCouch(t, allDocs(
+		"{\"id\":\"a\",\"key\":\"a\",\"value\":{\"rev\":\"1-a\"}},"+
+			"{\"id\":\"b\",\"key\":\"b\",\"value\":{\"rev\":\"1-b\"}},"+
+			"{\"id\":\"c\",\"key\":\"c\",\"value\":{\"rev\":\"1-c\"}},"+
+			"{\"id\":\"d\",\"key\":\"d\",\"value\":{\"rev\":\"1-d\"}},"+
+			"{\"id\":\"e\",\"key\":\"e\",\"value\":{\"rev\":\"1-e\"}}"))
+	defer srvB.Close()
+	missingInB, missingInA, err := Diff(a, b)
+	if err != nil {
+		t.Fatal("error not nil", err)
+	}
+	if fmt.Sprint(missingInB) != "[b f]" || fmt.Sprint(missingInA) != "[b c e]" {
+		t.Fatal("invalid diff", missingInB, missingInA)
+	}
+	broken, srvBroken := newTestCouch(t, allDocs(""))
+	defer srvBroken.Close()
+	if _, _, err = Diff(a, broken); err == nil {
+		t.Fatal("error nil")
+	}
+	if _, _, err = Diff(broken, b); err == nil {
+		t.Fatal("error nil")
+	}
+}
@@ -0,0 +1,61 @@
+package couch
+
+import (
+	"time"
+)
+
+// ExpiresAtField is the document field SetExpiry stores the expiry time in,
+// formatted as RFC 3339 in UTC so it sorts chronologically.
+const ExpiresAtField = "expires_at"
+
+// ExpiryMapFunc is a map function for the view PurgeExpired expects, emitting
+// the expiry time as key and the revision as value.
+const ExpiryMapFunc = "function(doc) { if (doc." + ExpiresAtField + ") { emit(doc." + ExpiresAtField + ", doc._rev); } }"
+
+// SetExpiry records in doc that it expires at t.
+func SetExpiry(doc map[string]interface{}, t time.Time) {
+	doc[ExpiresAtField] = t.UTC().Format(time.RFC3339)
+}
+
+// PurgeExpired purges the documents that expired before the given time, in
+// batches of c.PurgeBatchSize, and returns how many were purged. CouchDB has no
+// expiry of its own, so this is meant to be run periodically. view of design
+// document ddoc must emit the expiry as key and the revision as value, like
+// ExpiryMapFunc does.
+func (c *Couch) PurgeExpired(ddoc, view string, before time.Time) (int, error) {
+	batch := c.PurgeBatchSize
+	if batch < 1 {
+		batch = 100
+	}
+	inclusiveEnd := false
+	opts := ViewOptions{
+		EndKey:       before.UTC().Format(time.RFC3339),
+		InclusiveEnd: &inclusiveEnd,
+		Limit:        batch,
+	}
+	purged := 0
+	for {
+		result, err := c.View(ddoc, view, opts)
+		if err != nil {
+			return purged, err
+		}
+		if len(result.Rows) == 0 {
+			return purged, nil
+		}
+		docs := make(map[Id][]Rev, len(result.Rows))
+		for _, row := range result.Rows {
+			if rev, ok := row.Value.(string); ok {
+				docs[row.Id] = append(docs[row.Id], Rev(rev))
+			}
+		}
+		revs, err := c.Purge(docs)
+		if err != nil {
+			return purged, err
+		}
+		purged += len(revs)
+		// Stop if nothing could be purged, the view would return the same rows
+		if len(revs) == 0 || len(result.Rows) < batch {
+			return purged, nil
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package couch
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSetExpiry(t *testing.T) {
+	doc := map[string]interface{}{}
+	SetExpiry(doc, time.Date(2024, 3, 1, 12, 0, 0, 0, time.FixedZone("CET", 3600)))
+	if doc["expires_at"] != "2024-03-01T11:00:00Z" {
+		t.Fatal("invalid expiry", doc)
+	}
+}
+
+func TestPurgeExpired(t *testing.T) {
+	var mu sync.Mutex
+	expiry := map[Id]string{
+		"a": "2024-01-01T00:00:00Z",
+		"b": "2024-01-02T00:00:00Z",
+		"c": "2024-01-03T00:00:00Z",
+		"d": "2024-02-01T00:00:00Z",
+	}
+	couch, srv := newTestCouch(t, func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		switch r.URL.Path {
+		case "/mydb/_design/expiry/_view/by_expiry":
+			q := r.URL.Query()
+			var end string
+			json.Unmarshal([]byte(q.Get("endkey")), &end)
+			if q.Get("inclusive_end") != "false" || q.Get("limit") != "2" {
+				t.Error("invalid query", q)
+			}
+			var ids []string
+			for id, exp := range expiry {
+				if exp < end {
+					ids = append(ids, string(id))
+				}
+			}
+			sort.Strings(ids)
+			if len(ids) > 2 {
+				ids = ids[:2]
+			}
+			rows := []map[string]interface{}{}
+			for _, id := range ids {
+				rows = append(rows, map[string]interface{}{"id": id, "key": expiry[Id(id)], "value": "1-" + id})
+			}
+			writeJSON(w, 200, map[string]interface{}{"total_rows": len(expiry), "offset": 0, "rows": rows})
+		case "/mydb/_purge":
+			var docs map[Id][]Rev
+			json.NewDecoder(r.Body).Decode(&docs)
+			for id, revs := range docs {
+				if len(revs) != 1 || revs[0] != Rev("1-"+id) {
+					t.Error("invalid revs", id, revs)
+				}
+				delete(expiry, id)
+			}
+			writeJSON(w, 201, map[string]interface{}{"purge_seq": nil, "purged": docs})
+		default:
+			t.Error("invalid path", r.URL.Path)
+		}
+	})
+	defer srv.Close()
+	couch.PurgeBatchSize = 2
+	n, err := couch.PurgeExpired("expiry", "by_expiry", time.Date(2024, 1, 15, 0, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatal("error not nil", err)
+	}
+	if n != 3 || len(expiry) != 1 || expiry["d"] == "" {
+		t.Fatal("invalid purge", n, expiry)
+	}
+	if n, err = couch.PurgeExpired("expiry", "by_expiry", time.Date(2024, 1, 15, 0, 0, 0, 0, time.UTC)); err != nil || n != 0 {
+		t.Fatal("expected nothing to purge", n, err)
+	}
+}
@@ -0,0 +1,52 @@
+package couch
+
+import (
+	"encoding/json"
+)
+
+// FindQuery is a Mango query for Find. Selector is required, all other fields
+// are optional.
+type FindQuery struct {
+	Selector interface{}   `json:"selector"`
+	Fields   []string      `json:"fields,omitempty"`
+	Sort     []interface{} `json:"sort,omitempty"`
+	Limit    int           `json:"limit,omitempty"`
+	Skip     int           `json:"skip,omitempty"`
+	UseIndex interface{}   `json:"use_index,omitempty"`
+	Bookmark string        `json:"bookmark,omitempty"`
+
+	// ExecutionStats requests statistics about the query execution, returned
+	// in FindResult.ExecutionStats
+	ExecutionStats bool `json:"execution_stats,omitempty"`
+}
+
+// ExecutionStats describes how much work CouchDB did to answer a query.
+type ExecutionStats struct {
+	TotalKeysExamined       uint64  `json:"total_keys_examined"`
+	TotalDocsExamined       uint64  `json:"total_docs_examined"`
+	TotalQuorumDocsExamined uint64  `json:"total_quorum_docs_examined"`
+	ResultsReturned         uint64  `json:"results_returned"`
+	ExecutionTimeMs         float64 `json:"execution_time_ms"`
+}
+
+// FindResult is the result of Find. Warning is set by CouchDB e.g. if no
+// index matched the query and all documents had to be scanned.
+type FindResult struct {
+	Docs           []json.RawMessage `json:"docs"`
+	Bookmark       string            `json:"bookmark"`
+	Warning        string            `json:"warning"`
+	ExecutionStats *ExecutionStats   `json:"execution_stats"`
+}
+
+// Find runs a Mango query against the database.
+func (c *Couch) Find(q *FindQuery) (*FindResult, error) {
+	u, err := c.dbURL("_find")
+	if err != nil {
+		return nil, err
+	}
+	result := &FindResult{}
+	if _, err := c.doJSON("POST", u, q, result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
@@ -0,0 +1,49 @@
+package couch
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+)
+
+func TestFind(t *testing.T) {
+	couch, srv := newTestCouch(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" || r.URL.Path != "/mydb/_find" {
+			t.Error("invalid request", r.Method, r.URL.Path)
+		}
+		var q map[string]interface{}
+		if err := json.NewDecoder(r.Body).Decode(&q); err != nil {
+			t.Error("invalid body", err)
+		}
+		if q["execution_stats"] == true {
+			w.Write([]byte("{\"docs\":[{\"_id\":\"a\",\"age\":30}],\"bookmark\":\"g1\"," +
+				"\"warning\":\"No matching index found, create an index to optimize query time.\"," +
+				"\"execution_stats\":{\"total_keys_examined\":0,\"total_docs_examined\":200,\"total_quorum_docs_examined\":0," +
+				"\"results_returned\":1,\"execution_time_ms\":5.52}}"))
+			return
+		}
+		if _, ok := q["limit"]; ok {
+			t.Error("unset limit sent", q)
+		}
+		w.Write([]byte("{\"docs\":[],\"bookmark\":\"nil\"}"))
+	})
+	defer srv.Close()
+	result, err := couch.Find(&FindQuery{Selector: map[string]interface{}{"age": 30}})
+	if err != nil {
+		t.Fatal("error not nil", err)
+	}
+	if len(result.Docs) != 0 || result.Warning != "" || result.ExecutionStats != nil {
+		t.Fatal("invalid result", result)
+	}
+	result, err = couch.Find(&FindQuery{Selector: map[string]interface{}{"age": 30}, ExecutionStats: true})
+	if err != nil {
+		t.Fatal("error not nil", err)
+	}
+	if len(result.Docs) != 1 || result.Bookmark != "g1" || result.Warning == "" {
+		t.Fatal("invalid result", result)
+	}
+	stats := result.ExecutionStats
+	if stats == nil || stats.TotalDocsExamined != 200 || stats.ResultsReturned != 1 || stats.ExecutionTimeMs != 5.52 {
+		t.Fatal("invalid execution stats", stats)
+	}
+}
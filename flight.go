@@ -0,0 +1,55 @@
+package couch
+
+import (
+	"net/http"
+	"sync"
+)
+
+// flightGroup coalesces concurrent calls with the same key into a single
+// call whose result all callers share.
+type flightGroup struct {
+	mu    sync.Mutex
+	calls map[string]*flightCall
+}
+
+type flightCall struct {
+	wg   sync.WaitGroup
+	resp *http.Response
+	body []byte
+	err  error
+}
+
+// do calls fn, unless a call with key is in flight, in which case it waits
+// for that call and returns its result instead.
+func (g *flightGroup) do(key string, fn func() (*http.Response, []byte, error)) (*http.Response, []byte, error) {
+	g.mu.Lock()
+	if g.calls == nil {
+		g.calls = make(map[string]*flightCall)
+	}
+	if call, ok := g.calls[key]; ok {
+		g.mu.Unlock()
+		call.wg.Wait()
+		return call.resp, call.body, call.err
+	}
+	call := &flightCall{}
+	call.wg.Add(1)
+	g.calls[key] = call
+	g.mu.Unlock()
+
+	call.resp, call.body, call.err = fn()
+	call.wg.Done()
+
+	g.mu.Lock()
+	delete(g.calls, key)
+	g.mu.Unlock()
+	return call.resp, call.body, call.err
+}
+
+// flightKey identifies a GET of u by the credentials it's sent with, so
+// clients created with As don't share responses.
+func (c *Couch) flightKey(u string) string {
+	if p := c.ProxyAuth; p != nil {
+		return u + " proxy " + p.Name
+	}
+	return u + " " + c.url.User.String()
+}
@@ -0,0 +1,51 @@
+package couch
+
+import (
+	"net/http"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCoalesceGets(t *testing.T) {
+	var hits int32
+	release := make(chan struct{})
+	couch, srv := newTestCouch(t, func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		<-release
+		w.Write([]byte("{\"_id\":\"hot\",\"_rev\":\"1-a\",\"n\":1}"))
+	})
+	defer srv.Close()
+	couch.CoalesceGets = true
+	get := func(c *Couch, wg *sync.WaitGroup) {
+		defer wg.Done()
+		var doc struct {
+			N int `json:"n"`
+		}
+		if err := c.Get("hot", &doc); err != nil || doc.N != 1 {
+			t.Error("invalid get", doc, err)
+		}
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go get(couch, &wg)
+	}
+	// Let all Gets join the request in flight
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	if n := atomic.LoadInt32(&hits); n != 1 {
+		t.Fatal("expected a single request, got", n)
+	}
+	// Other credentials don't share requests
+	wg.Add(2)
+	go get(couch, &wg)
+	go get(couch.As(url.UserPassword("bob", "pw")), &wg)
+	wg.Wait()
+	if n := atomic.LoadInt32(&hits); n != 3 {
+		t.Fatal("expected separate requests, got", n)
+	}
+}
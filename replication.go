@@ -0,0 +1,257 @@
+package couch
+
+import (
+	"errors"
+	"strings"
+)
+
+// ReplicationCheckpoint returns the checkpoint document a replicator stored as
+// _local/replicationID, and its revision. If there is no checkpoint yet, the
+// document is nil and no error is returned.
+func (c *Couch) ReplicationCheckpoint(replicationID string) (map[string]interface{}, Rev, error) {
+	var doc map[string]interface{}
+	if err := c.Get(Id("_local/"+replicationID), &doc); err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return nil, "", nil
+		}
+		return nil, "", err
+	}
+	rev, _ := doc["_rev"].(string)
+	return doc, Rev(rev), nil
+}
+
+// SetReplicationCheckpoint stores the checkpoint document of replicationID.
+// rev is the revision returned by ReplicationCheckpoint, empty for the first
+// checkpoint. Local documents are not replicated themselves. Returns the new
+// revision.
+func (c *Couch) SetReplicationCheckpoint(replicationID string, rev Rev, doc map[string]interface{}) (Rev, error) {
+	return c.Update(Id("_local/"+replicationID), rev, doc)
+}
+
+// Replication describes a replication between two databases, given as names
+// on the same server or as URLs. It's the body of a Replicate request and, in
+// the _replicator database, a persistent replication document.
+type Replication struct {
+	Document
+	Source       string            `json:"source"`
+	Target       string            `json:"target"`
+	Continuous   bool              `json:"continuous,omitempty"`
+	CreateTarget bool              `json:"create_target,omitempty"`
+	DocIds       []Id              `json:"doc_ids,omitempty"` // Only replicate these documents
+	Filter       string            `json:"filter,omitempty"`  // Filter function as "ddoc/name"
+	QueryParams  map[string]string `json:"query_params,omitempty"`
+
+	// Selector only replicates the documents matching the Mango selector,
+	// on CouchDB 2.0 and later. It's much faster than a filter function,
+	// which has to run in the JavaScript query server.
+	Selector map[string]interface{} `json:"selector,omitempty"`
+}
+
+// ReplicateResult is the response to a Replicate request.
+type ReplicateResult struct {
+	Ok        bool   `json:"ok"`
+	SessionId string `json:"session_id"`
+	NoChanges bool   `json:"no_changes"`
+	LocalId   string `json:"_local_id"` // Replication id of continuous replications
+}
+
+// Replicate starts the transient replication r. Unless r is continuous the
+// request blocks until the replication is done.
+func (c *Couch) Replicate(r *Replication) (*ReplicateResult, error) {
+	result := &ReplicateResult{}
+	if _, err := c.Do("POST", "/_replicate", r, result, nil); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// AddReplication stores r in the _replicator database, so the replication is
+// resumed after a server restart. Returns the id and revision of the document.
+func (c *Couch) AddReplication(r *Replication) (Id, Rev, error) {
+	return c.DB("_replicator").Insert(r)
+}
+
+// ReplicationStatus describes the progress of a replication.
+type ReplicationStatus struct {
+	Id               string // Replication id
+	DocId            string // Id of the document in _replicator, if any
+	Source           string
+	Target           string
+	Continuous       bool
+	Running          bool
+	DocsRead         uint64
+	DocsWritten      uint64
+	DocWriteFailures uint64
+	ChangesPending   uint64
+}
+
+// activeTask is a replication listed in _active_tasks.
+type activeTask struct {
+	Type             string `json:"type"`
+	ReplicationId    string `json:"replication_id"`
+	DocId            string `json:"doc_id"`
+	Source           string `json:"source"`
+	Target           string `json:"target"`
+	Continuous       bool   `json:"continuous"`
+	DocsRead         uint64 `json:"docs_read"`
+	DocsWritten      uint64 `json:"docs_written"`
+	DocWriteFailures uint64 `json:"doc_write_failures"`
+	ChangesPending   uint64 `json:"changes_pending"`
+}
+
+// ReplicationStatus returns the status of the replication with the given id,
+// which is either the replication id returned when it was started or the id
+// of its _replicator document. The scheduler of CouchDB 2.1 and later is
+// asked first, falling back to _active_tasks on older servers. Returns
+// ErrNotFound if there is no such replication.
+func (c *Couch) ReplicationStatus(id string) (*ReplicationStatus, error) {
+	jobs, err := c.SchedulerJobs()
+	// CouchDB 1.x and 2.0 take _scheduler for an illegal database name
+	if e, ok := err.(*CouchError); ok && (e.StatusCode == 400 || e.StatusCode == 404) {
+		return c.activeTaskStatus(id)
+	}
+	if err != nil {
+		return nil, err
+	}
+	for _, job := range jobs {
+		if matchReplication(id, job.Id, job.DocId) {
+			status := job.Info.status(job.Id, job.DocId, job.Source, job.Target)
+			status.Running = true
+			return status, nil
+		}
+	}
+	// Finished and failing replications are only listed as documents
+	docs, err := c.SchedulerDocs()
+	if err != nil {
+		return nil, err
+	}
+	for _, doc := range docs {
+		if matchReplication(id, doc.Id, doc.DocId) {
+			status := doc.Info.status(doc.Id, doc.DocId, doc.Source, doc.Target)
+			status.Running = doc.State == "running"
+			return status, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+// matchReplication reports whether id is the replication id, with or without
+// the +continuous suffix, or the _replicator document id of a replication.
+func matchReplication(id, replicationId, docId string) bool {
+	return id != "" && (id == replicationId || id == strings.SplitN(replicationId, "+", 2)[0] || id == docId)
+}
+
+// activeTaskStatus looks up the replication with the given id in
+// _active_tasks, which only lists running replications.
+func (c *Couch) activeTaskStatus(id string) (*ReplicationStatus, error) {
+	var tasks []activeTask
+	if _, err := c.Do("GET", "/_active_tasks", nil, &tasks, nil); err != nil {
+		return nil, err
+	}
+	for _, task := range tasks {
+		if task.Type != "replication" || !matchReplication(id, task.ReplicationId, task.DocId) {
+			continue
+		}
+		return &ReplicationStatus{
+			Id:               task.ReplicationId,
+			DocId:            task.DocId,
+			Source:           task.Source,
+			Target:           task.Target,
+			Continuous:       task.Continuous,
+			Running:          true,
+			DocsRead:         task.DocsRead,
+			DocsWritten:      task.DocsWritten,
+			DocWriteFailures: task.DocWriteFailures,
+			ChangesPending:   task.ChangesPending,
+		}, nil
+	}
+	return nil, ErrNotFound
+}
+
+// ReplicationInfo holds the statistics of a replication reported by the
+// scheduler. Error is set for replications that are failing.
+type ReplicationInfo struct {
+	RevisionsChecked      uint64 `json:"revisions_checked"`
+	MissingRevisionsFound uint64 `json:"missing_revisions_found"`
+	DocsRead              uint64 `json:"docs_read"`
+	DocsWritten           uint64 `json:"docs_written"`
+	DocWriteFailures      uint64 `json:"doc_write_failures"`
+	ChangesPending        uint64 `json:"changes_pending"`
+	CheckpointedSourceSeq Seq    `json:"checkpointed_source_seq"`
+	SourceSeq             Seq    `json:"source_seq"`
+	ThroughSeq            Seq    `json:"through_seq"`
+	Error                 string `json:"error"`
+}
+
+func (info *ReplicationInfo) status(id, docId, source, target string) *ReplicationStatus {
+	return &ReplicationStatus{
+		Id:               id,
+		DocId:            docId,
+		Source:           source,
+		Target:           target,
+		Continuous:       strings.HasSuffix(id, "+continuous"),
+		DocsRead:         info.DocsRead,
+		DocsWritten:      info.DocsWritten,
+		DocWriteFailures: info.DocWriteFailures,
+		ChangesPending:   info.ChangesPending,
+	}
+}
+
+// SchedulerEvent is an entry in the history of a replication job.
+type SchedulerEvent struct {
+	Timestamp string `json:"timestamp"`
+	Type      string `json:"type"` // E.g. "added", "started" or "crashed"
+	Reason    string `json:"reason"`
+}
+
+// SchedulerJob is a running replication listed in _scheduler/jobs.
+type SchedulerJob struct {
+	Id        string           `json:"id"`
+	Database  string           `json:"database"` // Replicator database, empty for transient replications
+	DocId     string           `json:"doc_id"`
+	Source    string           `json:"source"`
+	Target    string           `json:"target"`
+	Node      string           `json:"node"`
+	StartTime string           `json:"start_time"`
+	Info      ReplicationInfo  `json:"info"`
+	History   []SchedulerEvent `json:"history"`
+}
+
+// SchedulerDoc is the state of a replication document, listed in
+// _scheduler/docs.
+type SchedulerDoc struct {
+	Id          string          `json:"id"` // Replication id, empty until the replication was scheduled
+	Database    string          `json:"database"`
+	DocId       string          `json:"doc_id"`
+	Source      string          `json:"source"`
+	Target      string          `json:"target"`
+	State       string          `json:"state"` // E.g. "running", "pending", "crashing" or "completed"
+	ErrorCount  int             `json:"error_count"`
+	Node        string          `json:"node"`
+	StartTime   string          `json:"start_time"`
+	LastUpdated string          `json:"last_updated"`
+	Info        ReplicationInfo `json:"info"`
+}
+
+// SchedulerJobs returns the running replications of CouchDB 2.1 and later.
+func (c *Couch) SchedulerJobs() ([]*SchedulerJob, error) {
+	var v struct {
+		Jobs []*SchedulerJob `json:"jobs"`
+	}
+	if _, err := c.Do("GET", "/_scheduler/jobs", nil, &v, nil); err != nil {
+		return nil, err
+	}
+	return v.Jobs, nil
+}
+
+// SchedulerDocs returns the replication documents of all replicator databases
+// and their state, on CouchDB 2.1 and later.
+func (c *Couch) SchedulerDocs() ([]*SchedulerDoc, error) {
+	var v struct {
+		Docs []*SchedulerDoc `json:"docs"`
+	}
+	if _, err := c.Do("GET", "/_scheduler/docs", nil, &v, nil); err != nil {
+		return nil, err
+	}
+	return v.Docs, nil
+}
@@ -0,0 +1,181 @@
+package couch
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+)
+
+func TestReplicationCheckpoint(t *testing.T) {
+	store := newDocStore()
+	couch, srv := newTestCouch(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.EscapedPath() != "/mydb/_local/a1b2%2Fc3" {
+			t.Error("invalid path", r.URL.EscapedPath())
+		}
+		store.ServeHTTP(w, r)
+	})
+	defer srv.Close()
+	doc, rev, err := couch.ReplicationCheckpoint("a1b2/c3")
+	if err != nil {
+		t.Fatal("error not nil", err)
+	}
+	if doc != nil || rev != "" {
+		t.Fatal("expected no checkpoint", doc, rev)
+	}
+	rev, err = couch.SetReplicationCheckpoint("a1b2/c3", "", map[string]interface{}{"source_last_seq": "5-abc"})
+	if err != nil {
+		t.Fatal("error not nil", err)
+	}
+	doc, got, err := couch.ReplicationCheckpoint("a1b2/c3")
+	if err != nil {
+		t.Fatal("error not nil", err)
+	}
+	if got != rev || doc["source_last_seq"] != "5-abc" {
+		t.Fatal("invalid checkpoint", doc, got)
+	}
+	if _, err = couch.SetReplicationCheckpoint("a1b2/c3", rev, map[string]interface{}{"source_last_seq": "9-def"}); err != nil {
+		t.Fatal("error not nil", err)
+	}
+	if doc, _, _ = couch.ReplicationCheckpoint("a1b2/c3"); doc["source_last_seq"] != "9-def" {
+		t.Fatal("checkpoint not updated", doc)
+	}
+}
+
+func TestReplicationStatusActiveTasks(t *testing.T) {
+	couch, srv := newTestCouch(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/_scheduler/jobs" {
+			w.WriteHeader(400)
+			w.Write([]byte("{\"error\":\"illegal_database_name\",\"reason\":\"Name: '_scheduler'. Only lowercase characters (a-z), " +
+				"digits (0-9), and any of the characters _, $, (, ), +, -, and / are allowed. Must begin with a letter.\"}"))
+			return
+		}
+		if r.URL.Path != "/_active_tasks" {
+			t.Error("invalid path", r.URL.Path)
+		}
+		w.Write([]byte("[{\"type\":\"indexer\",\"database\":\"mydb\",\"progress\":50}," +
+			"{\"type\":\"replication\",\"replication_id\":\"c0ebe9256695ff083347cbf95f93e280+continuous\",\"doc_id\":\"sync\"," +
+			"\"source\":\"http://a/mydb/\",\"target\":\"http://b/mydb/\",\"continuous\":true,\"docs_read\":10,\"docs_written\":9," +
+			"\"doc_write_failures\":1,\"changes_pending\":20}]"))
+	})
+	defer srv.Close()
+	for _, id := range []string{"c0ebe9256695ff083347cbf95f93e280", "c0ebe9256695ff083347cbf95f93e280+continuous", "sync"} {
+		status, err := couch.ReplicationStatus(id)
+		if err != nil {
+			t.Fatal("error not nil", err)
+		}
+		if !status.Running || !status.Continuous || status.DocId != "sync" || status.DocsRead != 10 || status.DocsWritten != 9 ||
+			status.DocWriteFailures != 1 || status.ChangesPending != 20 || status.Target != "http://b/mydb/" {
+			t.Fatal("invalid status", status)
+		}
+	}
+	if _, err := couch.ReplicationStatus("other"); err != ErrNotFound {
+		t.Fatal("expected not found", err)
+	}
+}
+
+func TestReplicationStatusScheduler(t *testing.T) {
+	couch, srv := newTestCouch(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/_scheduler/jobs":
+			w.Write([]byte("{\"total_rows\":1,\"offset\":0,\"jobs\":[{\"database\":null,\"id\":\"abc+continuous\",\"doc_id\":null," +
+				"\"source\":\"http://a/mydb/\",\"target\":\"http://b/mydb/\",\"node\":\"node1@127.0.0.1\",\"start_time\":\"2024-01-01T00:00:00Z\"," +
+				"\"info\":{\"docs_read\":5,\"docs_written\":5,\"changes_pending\":null,\"checkpointed_source_seq\":\"12-g1\"}," +
+				"\"history\":[{\"timestamp\":\"2024-01-01T00:00:00Z\",\"type\":\"started\"}]}]}"))
+		case "/_scheduler/docs":
+			w.Write([]byte("{\"total_rows\":1,\"offset\":0,\"docs\":[{\"database\":\"_replicator\",\"doc_id\":\"backup\",\"id\":\"def\"," +
+				"\"source\":\"http://a/mydb/\",\"target\":\"http://c/mydb/\",\"state\":\"completed\",\"error_count\":0," +
+				"\"info\":{\"docs_read\":7,\"docs_written\":6,\"doc_write_failures\":1,\"changes_pending\":0}}]}"))
+		default:
+			t.Error("invalid path", r.URL.Path)
+		}
+	})
+	defer srv.Close()
+	jobs, err := couch.SchedulerJobs()
+	if err != nil {
+		t.Fatal("error not nil", err)
+	}
+	if len(jobs) != 1 || jobs[0].Info.CheckpointedSourceSeq != "12-g1" || len(jobs[0].History) != 1 || jobs[0].History[0].Type != "started" {
+		t.Fatal("invalid jobs", jobs)
+	}
+	docs, err := couch.SchedulerDocs()
+	if err != nil {
+		t.Fatal("error not nil", err)
+	}
+	if len(docs) != 1 || docs[0].State != "completed" || docs[0].Database != "_replicator" {
+		t.Fatal("invalid docs", docs)
+	}
+	status, err := couch.ReplicationStatus("abc")
+	if err != nil {
+		t.Fatal("error not nil", err)
+	}
+	if !status.Running || !status.Continuous || status.DocsWritten != 5 || status.ChangesPending != 0 {
+		t.Fatal("invalid status", status)
+	}
+	status, err = couch.ReplicationStatus("backup")
+	if err != nil {
+		t.Fatal("error not nil", err)
+	}
+	if status.Running || status.Continuous || status.Id != "def" || status.DocsRead != 7 || status.DocWriteFailures != 1 {
+		t.Fatal("invalid status", status)
+	}
+	if _, err = couch.ReplicationStatus("other"); err != ErrNotFound {
+		t.Fatal("expected not found", err)
+	}
+}
+
+func TestReplicate(t *testing.T) {
+	couch, srv := newTestCouch(t, func(w http.ResponseWriter, r *http.Request) {
+		var v map[string]interface{}
+		if err := json.NewDecoder(r.Body).Decode(&v); err != nil {
+			t.Error("invalid body", err)
+		}
+		selector, _ := v["selector"].(map[string]interface{})
+		if r.Method != "POST" || r.URL.Path != "/_replicate" || v["source"] != "a" || v["target"] != "b" || selector["type"] != "user" {
+			t.Error("invalid request", r.Method, r.URL.Path, v)
+		}
+		if _, ok := v["filter"]; ok {
+			t.Error("filter sent", v)
+		}
+		w.Write([]byte("{\"ok\":true,\"session_id\":\"s1\"}"))
+	})
+	defer srv.Close()
+	result, err := couch.Replicate(&Replication{
+		Source:   "a",
+		Target:   "b",
+		Selector: map[string]interface{}{"type": "user"},
+	})
+	if err != nil {
+		t.Fatal("error not nil", err)
+	}
+	if !result.Ok || result.SessionId != "s1" {
+		t.Fatal("invalid result", result)
+	}
+}
+
+func TestAddReplication(t *testing.T) {
+	couch, srv := newTestCouch(t, func(w http.ResponseWriter, r *http.Request) {
+		var v map[string]interface{}
+		if err := json.NewDecoder(r.Body).Decode(&v); err != nil {
+			t.Error("invalid body", err)
+		}
+		if r.Method != "POST" || r.URL.Path != "/_replicator" || v["continuous"] != true || v["selector"] == nil {
+			t.Error("invalid request", r.Method, r.URL.Path, v)
+		}
+		w.WriteHeader(201)
+		w.Write([]byte("{\"ok\":true,\"id\":\"r1\",\"rev\":\"1-a\"}"))
+	})
+	defer srv.Close()
+	r := &Replication{
+		Source:     "a",
+		Target:     "b",
+		Continuous: true,
+		Selector:   map[string]interface{}{"type": "user"},
+	}
+	id, rev, err := couch.AddReplication(r)
+	if err != nil {
+		t.Fatal("error not nil", err)
+	}
+	if id != "r1" || rev != "1-a" || r.Id != "r1" || r.Rev != "1-a" {
+		t.Fatal("invalid id or rev", id, rev, r.Document)
+	}
+}
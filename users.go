@@ -0,0 +1,82 @@
+package couch
+
+import (
+	"fmt"
+)
+
+// UsersDb is the name of the database holding the user documents.
+const UsersDb = "_users"
+
+// userIdPrefix is the id prefix of documents in the _users database.
+const userIdPrefix = "org.couchdb.user:"
+
+// UserId returns the id of the user document of name.
+func UserId(name string) Id {
+	return Id(userIdPrefix + name)
+}
+
+// User is a document of the _users database. Password is only sent to set a
+// new password, CouchDB replaces it with the hash fields on write.
+type User struct {
+	Document
+	Name     string   `json:"name"`
+	Type     string   `json:"type"`
+	Roles    []string `json:"roles"`
+	Password string   `json:"password,omitempty"`
+
+	PasswordScheme string `json:"password_scheme,omitempty"`
+	Iterations     int    `json:"iterations,omitempty"`
+	Pbkdf2Prf      string `json:"pbkdf2_prf,omitempty"`
+	DerivedKey     string `json:"derived_key,omitempty"`
+	Salt           string `json:"salt,omitempty"`
+}
+
+// Users returns a client for the _users database on the same server.
+func (c *Couch) Users() *Couch {
+	return c.DB(UsersDb)
+}
+
+// CreateUser creates the user name in the _users database. The password is
+// hashed by CouchDB when the document is stored.
+func (c *Couch) CreateUser(name, password string, roles []string) (Id, Rev, error) {
+	if name == "" {
+		return "", "", fmt.Errorf("user name not set")
+	}
+	if roles == nil {
+		roles = []string{}
+	}
+	user := &User{
+		Name:     name,
+		Type:     "user",
+		Roles:    roles,
+		Password: password,
+	}
+	id := UserId(name)
+	rev, err := c.Users().Update(id, "", user)
+	if err != nil {
+		return "", "", err
+	}
+	return id, rev, nil
+}
+
+// UpdateUser applies fn to the user document of name and stores it, retrying
+// on conflicts like Mutate. The stored password hash is written back as is, so
+// the user can still log in afterwards. To change the password, fn sets
+// Password, or use ChangePassword.
+func (c *Couch) UpdateUser(name string, fn func(u *User) error) (Rev, error) {
+	return Mutate(c.Users(), UserId(name), func(u *User) error {
+		u.Password = ""
+		return fn(u)
+	})
+}
+
+// ChangePassword sets a new password for the user name.
+func (c *Couch) ChangePassword(name, password string) (Rev, error) {
+	if password == "" {
+		return "", fmt.Errorf("password not set")
+	}
+	return c.UpdateUser(name, func(u *User) error {
+		u.Password = password
+		return nil
+	})
+}
@@ -0,0 +1,110 @@
+package couch
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestCreateUser(t *testing.T) {
+	couch, srv := newTestCouch(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "PUT" || r.URL.Path != "/_users/org.couchdb.user:jan" || r.URL.RawQuery != "" {
+			t.Error("invalid request", r.Method, r.URL)
+		}
+		var doc map[string]interface{}
+		if err := json.NewDecoder(r.Body).Decode(&doc); err != nil {
+			t.Error("invalid body", err)
+		}
+		if doc["name"] != "jan" || doc["type"] != "user" || doc["password"] != "secret" {
+			t.Error("invalid user", doc)
+		}
+		if roles, ok := doc["roles"].([]interface{}); !ok || len(roles) != 0 {
+			t.Error("invalid roles", doc["roles"])
+		}
+		if _, ok := doc["_rev"]; ok {
+			t.Error("rev set on new user", doc)
+		}
+		w.WriteHeader(201)
+		w.Write([]byte("{\"ok\":true,\"id\":\"org.couchdb.user:jan\",\"rev\":\"1-a\"}"))
+	})
+	defer srv.Close()
+	if couch.Users().Db() != "_users" || couch.Db() != "mydb" {
+		t.Fatal("invalid dbs", couch.Users().Db(), couch.Db())
+	}
+	id, rev, err := couch.CreateUser("jan", "secret", nil)
+	if err != nil {
+		t.Fatal("error not nil", err)
+	}
+	if id != "org.couchdb.user:jan" || rev != "1-a" {
+		t.Fatal("invalid id or rev", id, rev)
+	}
+	if _, _, err = couch.CreateUser("", "secret", nil); err == nil {
+		t.Fatal("error nil")
+	}
+}
+
+func TestUpdateUser(t *testing.T) {
+	store := newDocStore()
+	store.docs["org.couchdb.user:jan"] = map[string]interface{}{
+		"_id":             "org.couchdb.user:jan",
+		"_rev":            "1-a",
+		"name":            "jan",
+		"type":            "user",
+		"roles":           []interface{}{},
+		"password_scheme": "pbkdf2",
+		"iterations":      float64(10),
+		"derived_key":     "abc",
+		"salt":            "def",
+		"email":           "jan@example.com",
+	}
+	couch, srv := newTestCouch(t, func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.URL.Path, "/_users/") {
+			t.Error("invalid path", r.URL.Path)
+		}
+		r.URL.Path = "/mydb/" + strings.TrimPrefix(r.URL.Path, "/_users/")
+		store.ServeHTTP(w, r)
+	})
+	defer srv.Close()
+	_, err := couch.UpdateUser("jan", func(u *User) error {
+		u.Roles = append(u.Roles, "staff")
+		return nil
+	})
+	if err != nil {
+		t.Fatal("error not nil", err)
+	}
+	doc := store.docs["org.couchdb.user:jan"]
+	if roles, ok := doc["roles"].([]interface{}); !ok || len(roles) != 1 || roles[0] != "staff" {
+		t.Fatal("roles not updated", doc)
+	}
+	if _, ok := doc["password"]; ok {
+		t.Fatal("password sent on update", doc)
+	}
+	if doc["derived_key"] != "abc" || doc["salt"] != "def" || doc["password_scheme"] != "pbkdf2" ||
+		doc["iterations"] != float64(10) || doc["email"] != "jan@example.com" {
+		t.Fatal("fields not preserved", doc)
+	}
+	if _, err = couch.UpdateUser("jan", func(u *User) error {
+		u.DerivedKey, u.Salt = "", ""
+		return nil
+	}); err != nil {
+		t.Fatal("error not nil", err)
+	}
+	doc = store.docs["org.couchdb.user:jan"]
+	if _, ok := doc["salt"]; ok || doc["derived_key"] != nil || doc["email"] != "jan@example.com" {
+		t.Fatal("cleared fields written back", doc)
+	}
+	if _, err = couch.ChangePassword("jan", "new"); err != nil {
+		t.Fatal("error not nil", err)
+	}
+	if doc = store.docs["org.couchdb.user:jan"]; doc["password"] != "new" || doc["_rev"] != "4-4" {
+		t.Fatal("password not set", doc)
+	}
+	if _, err = couch.ChangePassword("jan", ""); err == nil {
+		t.Fatal("error nil")
+	}
+	if _, err = couch.UpdateUser("missing", func(u *User) error { return nil }); !errors.Is(err, ErrNotFound) {
+		t.Fatal("expected not found", err)
+	}
+}
@@ -0,0 +1,432 @@
+package couch
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// ViewOptions are the query parameters of a view request, a typed
+// alternative to the queryPairs of Query. Zero values aren't sent, so the
+// server defaults apply. Keys are JSON encoded, all other values are sent
+// as is.
+type ViewOptions struct {
+	Key           interface{}   // Only return rows matching key
+	Keys          []interface{} // Only return rows matching any of keys
+	StartKey      interface{}
+	StartKeyDocID Id // Document id to start with, to paginate duplicate start keys
+	EndKey        interface{}
+	EndKeyDocID   Id // Last document id to include, to paginate duplicate end keys
+	Limit         int
+	Stale         string // "ok" or "update_after"
+	Descending    bool
+	Skip          int
+	Group         bool
+	GroupLevel    int
+	Reduce        *bool // Defaults to true if the view has a reduce function
+	IncludeDocs   bool
+	InclusiveEnd  *bool // Defaults to true
+	UpdateSeq     bool
+
+	// Extra are additional query parameters, for server features without a
+	// field. They are sent as is and replace the parameters set by the other
+	// fields.
+	Extra url.Values
+
+	// StaleFallback makes View retry a query that failed with a server
+	// error with stale=ok. It isn't sent to the server.
+	StaleFallback bool
+}
+
+// Key is an array key of a view, like [year, month, day], for the key options
+// of ViewOptions.
+type Key []interface{}
+
+// highKey encodes as {}, which sorts after all other JSON values.
+type highKey struct{}
+
+// HighKey sorts after all other values in view collation. As last element of
+// an end key it includes all keys starting with the preceding elements.
+var HighKey = highKey{}
+
+// Range returns the start and end key of all keys starting with the elements
+// of k, so Key{2024, 1}.Range() selects the keys from [2024,1] to
+// [2024,1,{}], which include all days of the month.
+func (k Key) Range() (start, end Key) {
+	start = append(Key{}, k...)
+	end = append(append(Key{}, k...), HighKey)
+	return start, end
+}
+
+// values encodes the options as query parameters.
+func (o ViewOptions) values() (url.Values, error) {
+	v := url.Values{}
+	for k, key := range map[string]interface{}{
+		PKey:      o.Key,
+		PStartKey: o.StartKey,
+		PEndKey:   o.EndKey,
+	} {
+		if key != nil {
+			b, err := json.Marshal(key)
+			if err != nil {
+				return nil, err
+			}
+			v.Set(k, string(b))
+		}
+	}
+	if o.Keys != nil {
+		b, err := json.Marshal(o.Keys)
+		if err != nil {
+			return nil, err
+		}
+		v.Set(PKeys, string(b))
+	}
+	if o.StartKeyDocID != "" {
+		v.Set(PStartKeyDocID, string(o.StartKeyDocID))
+	}
+	if o.EndKeyDocID != "" {
+		v.Set(PEndKeyDocID, string(o.EndKeyDocID))
+	}
+	if o.Limit > 0 {
+		v.Set(PLimit, strconv.Itoa(o.Limit))
+	}
+	if o.Stale != "" {
+		v.Set(PStale, o.Stale)
+	}
+	if o.Descending {
+		v.Set(PDescending, "true")
+	}
+	if o.Skip > 0 {
+		v.Set(PSkip, strconv.Itoa(o.Skip))
+	}
+	if o.Group {
+		v.Set(PGroup, "true")
+	}
+	if o.GroupLevel > 0 {
+		v.Set(PGroupLevel, strconv.Itoa(o.GroupLevel))
+	}
+	if o.Reduce != nil {
+		v.Set(PReduce, strconv.FormatBool(*o.Reduce))
+	}
+	if o.IncludeDocs {
+		v.Set(PIncludeDocs, "true")
+	}
+	if o.InclusiveEnd != nil {
+		v.Set(PInclusiveEnd, strconv.FormatBool(*o.InclusiveEnd))
+	}
+	if o.UpdateSeq {
+		v.Set(PUpdateSeq, "true")
+	}
+	for k, vs := range o.Extra {
+		v[k] = vs
+	}
+	return v, nil
+}
+
+// object encodes the options as the JSON object of a query sent in a request
+// body, as ViewQueries does.
+func (o ViewOptions) object() (map[string]interface{}, error) {
+	v, err := o.values()
+	if err != nil {
+		return nil, err
+	}
+	obj := make(map[string]interface{}, len(v))
+	for k := range v {
+		switch k {
+		case PStartKeyDocID, PEndKeyDocID, PStale:
+			obj[k] = v.Get(k)
+		default:
+			// All other values are already valid JSON, except for extra
+			// parameters that are plain strings
+			if s := v.Get(k); json.Valid([]byte(s)) {
+				obj[k] = json.RawMessage(s)
+			} else {
+				obj[k] = s
+			}
+		}
+	}
+	return obj, nil
+}
+
+// QueryOpts is like Query but takes the query parameters as ViewOptions.
+func (c *Couch) QueryOpts(path string, bodyJson map[string]interface{}, opts ViewOptions) (*Result, error) {
+	v, err := opts.values()
+	if err != nil {
+		return nil, err
+	}
+	return c.query(context.Background(), path, bodyJson, v.Encode())
+}
+
+// View queries view of design document ddoc.
+//
+// Queries can fail with a server error while the index is rebuilt after a
+// design document change. If opts.StaleFallback is set such a query is retried
+// once with stale=ok, returning the rows of the existing index instead.
+func (c *Couch) View(ddoc, view string, opts ViewOptions) (*Result, error) {
+	return c.view(context.Background(), ddoc, view, opts)
+}
+
+func (c *Couch) view(ctx context.Context, ddoc, view string, opts ViewOptions) (*Result, error) {
+	path := "_design/" + escapeSegment(ddoc) + "/_view/" + escapeSegment(view)
+	v, err := opts.values()
+	if err != nil {
+		return nil, err
+	}
+	result, err := c.query(ctx, path, nil, v.Encode())
+	if e, ok := err.(*CouchError); ok && e.StatusCode >= 500 && opts.StaleFallback && opts.Stale != "ok" {
+		opts.Stale = "ok"
+		if v, err = opts.values(); err != nil {
+			return nil, err
+		}
+		return c.query(ctx, path, nil, v.Encode())
+	}
+	return result, err
+}
+
+// ViewQueries runs several queries of view in a single request and returns
+// their results in the order of queries.
+func (c *Couch) ViewQueries(ddoc, view string, queries []ViewOptions) ([]*Result, error) {
+	u, err := c.docURL(Id("_design/" + ddoc))
+	if err != nil {
+		return nil, err
+	}
+	objs := make([]map[string]interface{}, 0, len(queries))
+	for _, q := range queries {
+		obj, err := q.object()
+		if err != nil {
+			return nil, err
+		}
+		objs = append(objs, obj)
+	}
+	var v struct {
+		Results []*queryResponse `json:"results"`
+	}
+	body := map[string]interface{}{"queries": objs}
+	if _, err := c.doJSON("POST", u+"/_view/"+escapeSegment(view)+"/queries", body, &v); err != nil {
+		return nil, err
+	}
+	if len(v.Results) != len(queries) {
+		return nil, fmt.Errorf("expected %d results, got %d", len(queries), len(v.Results))
+	}
+	results := make([]*Result, 0, len(v.Results))
+	for _, r := range v.Results {
+		if r == nil {
+			return nil, fmt.Errorf("result not set")
+		}
+		result, err := r.result()
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+// ViewRequest is a view query for QueryMulti.
+type ViewRequest struct {
+	Ddoc    string
+	View    string
+	Options ViewOptions
+}
+
+// QueryMulti runs the view queries concurrently, c.QueryMultiWorkers at a
+// time, and returns their results in the order of queries. If a query fails,
+// or ctx is done, the queries still running are canceled and the first error
+// is returned.
+func (c *Couch) QueryMulti(ctx context.Context, queries []ViewRequest) ([]*Result, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	results := make([]*Result, len(queries))
+	jobs := make(chan int)
+	var (
+		wg       sync.WaitGroup
+		once     sync.Once
+		firstErr error
+	)
+	workers := c.QueryMultiWorkers
+	if workers < 1 {
+		workers = 4
+	}
+	for w := 0; w < workers && w < len(queries); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				q := queries[i]
+				result, err := c.view(ctx, q.Ddoc, q.View, q.Options)
+				if err != nil {
+					once.Do(func() {
+						firstErr = err
+						cancel()
+					})
+					continue
+				}
+				results[i] = result
+			}
+		}()
+	}
+feed:
+	for i := range queries {
+		select {
+		case jobs <- i:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(jobs)
+	wg.Wait()
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// ViewIndexInfo describes the state of a design document's view index.
+type ViewIndexInfo struct {
+	Name           string // Name of the design document
+	Signature      string
+	Language       string
+	UpdateSeq      uint64 // Database sequence the index reflects
+	PurgeSeq       uint64
+	DiskSize       uint64 // Size of the index file
+	DataSize       uint64 // Size of the live data in the index
+	UpdaterRunning bool   // Whether the index is currently being updated
+	CompactRunning bool
+	WaitingClients uint64
+	WaitingCommit  bool
+}
+
+// ViewInfo returns information about the view index of design document ddoc.
+func (c *Couch) ViewInfo(ddoc string) (*ViewIndexInfo, error) {
+	u, err := c.docURL(Id("_design/" + ddoc))
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.req("GET", u+"/_info", nil, nil, c.url.User)
+	if err != nil {
+		return nil, err
+	}
+	var v struct {
+		Name      string `json:"name"`
+		ViewIndex struct {
+			Signature      string `json:"signature"`
+			Language       string `json:"language"`
+			UpdateSeq      uint64 `json:"update_seq"`
+			PurgeSeq       uint64 `json:"purge_seq"`
+			DiskSize       uint64 `json:"disk_size"`
+			DataSize       uint64 `json:"data_size"`
+			UpdaterRunning bool   `json:"updater_running"`
+			CompactRunning bool   `json:"compact_running"`
+			WaitingClients uint64 `json:"waiting_clients"`
+			WaitingCommit  bool   `json:"waiting_commit"`
+			Sizes          struct {
+				File   uint64 `json:"file"`
+				Active uint64 `json:"active"`
+			} `json:"sizes"`
+		} `json:"view_index"`
+	}
+	if err := c.unmarshalInto(resp, 200, &v); err != nil {
+		return nil, err
+	}
+	vi := v.ViewIndex
+	info := &ViewIndexInfo{
+		Name:           v.Name,
+		Signature:      vi.Signature,
+		Language:       vi.Language,
+		UpdateSeq:      vi.UpdateSeq,
+		PurgeSeq:       vi.PurgeSeq,
+		DiskSize:       vi.DiskSize,
+		DataSize:       vi.DataSize,
+		UpdaterRunning: vi.UpdaterRunning,
+		CompactRunning: vi.CompactRunning,
+		WaitingClients: vi.WaitingClients,
+		WaitingCommit:  vi.WaitingCommit,
+	}
+	// CouchDB 2.0 replaced disk_size and data_size with sizes
+	if info.DiskSize == 0 {
+		info.DiskSize = vi.Sizes.File
+	}
+	if info.DataSize == 0 {
+		info.DataSize = vi.Sizes.Active
+	}
+	return info, nil
+}
+
+// pollInterval is the delay between status checks of the helpers waiting
+// for the server to finish background work.
+var pollInterval = 500 * time.Millisecond
+
+// WaitForView blocks until the view index of ddoc is up to date or ctx is
+// done. It queries view with limit=0, which CouchDB only answers once the
+// index has caught up with the database, so unlike polling updater_running it
+// can't return before the updater has even started. Clients with a Timeout
+// shorter than the index build fail with a timeout error.
+func (c *Couch) WaitForView(ctx context.Context, ddoc, view string) error {
+	_, err := c.view(ctx, ddoc, view, ViewOptions{Extra: url.Values{PLimit: {"0"}}})
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return err
+}
+
+// AllDocsByPrefix returns the documents whose id starts with prefix. The range
+// ends at prefix followed by "\ufff0", a code point higher than any commonly
+// used character, so all ids sharing the prefix sort before it. If out is
+// not nil, it must be a pointer to a slice the documents are decoded into.
+func (c *Couch) AllDocsByPrefix(prefix string, out interface{}) (*Result, error) {
+	result, err := c.QueryOpts("_all_docs", nil, ViewOptions{
+		StartKey:    prefix,
+		EndKey:      prefix + "\ufff0",
+		IncludeDocs: true,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if out != nil {
+		if err := c.decodeDocs(result, out); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+// InRange decodes the documents of the rows of view whose keys are in the
+// range from start up to but excluding end into out, which must be a pointer
+// to a slice. It's meant for views emitting timestamps, where the half-open
+// range makes consecutive ranges not overlap.
+func (c *Couch) InRange(ddoc, view string, start, end interface{}, out interface{}) error {
+	inclusiveEnd, reduce := false, false
+	result, err := c.View(ddoc, view, ViewOptions{
+		StartKey:     start,
+		EndKey:       end,
+		InclusiveEnd: &inclusiveEnd,
+		IncludeDocs:  true,
+		Reduce:       &reduce, // Rows of reduce views can't include docs
+	})
+	if err != nil {
+		return err
+	}
+	return c.decodeDocs(result, out)
+}
+
+// decodeDocs decodes the included documents of the rows of result into out.
+func (c *Couch) decodeDocs(result *Result, out interface{}) error {
+	docs := make([]json.RawMessage, 0, len(result.Rows))
+	for _, row := range result.Rows {
+		if row.Doc != nil {
+			docs = append(docs, row.Doc)
+		}
+	}
+	b, err := c.marshal(docs)
+	if err != nil {
+		return err
+	}
+	return c.unmarshal(b, out)
+}
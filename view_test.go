@@ -0,0 +1,381 @@
+package couch
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestViewInfo(t *testing.T) {
+	couch := &Couch{}
+	if _, err := couch.ViewInfo("orders"); err == nil {
+		t.Fatal("error nil")
+	}
+	couch, srv := newTestCouch(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/mydb/_design/v1/_info":
+			w.Write([]byte("{\"name\":\"v1\",\"view_index\":{\"signature\":\"abc\",\"language\":\"javascript\"," +
+				"\"update_seq\":12,\"purge_seq\":1,\"disk_size\":4096,\"data_size\":1024," +
+				"\"updater_running\":true,\"compact_running\":false,\"waiting_clients\":2,\"waiting_commit\":false}}"))
+		case "/mydb/_design/v2/_info":
+			w.Write([]byte("{\"name\":\"v2\",\"view_index\":{\"signature\":\"def\",\"language\":\"javascript\"," +
+				"\"update_seq\":7,\"purge_seq\":0,\"sizes\":{\"file\":8192,\"active\":2048,\"external\":512}," +
+				"\"updater_running\":false,\"compact_running\":false,\"waiting_clients\":0,\"waiting_commit\":false}}"))
+		default:
+			w.WriteHeader(404)
+			w.Write([]byte("{\"error\":\"not_found\",\"reason\":\"missing\"}"))
+		}
+	})
+	defer srv.Close()
+	info, err := couch.ViewInfo("v1")
+	if err != nil {
+		t.Fatal("error not nil", err)
+	}
+	if info.Name != "v1" || info.Signature != "abc" || info.UpdateSeq != 12 || info.PurgeSeq != 1 ||
+		info.DiskSize != 4096 || info.DataSize != 1024 || !info.UpdaterRunning || info.WaitingClients != 2 {
+		t.Fatal("invalid info", info)
+	}
+	info, err = couch.ViewInfo("v2")
+	if err != nil {
+		t.Fatal("error not nil", err)
+	}
+	if info.Name != "v2" || info.UpdateSeq != 7 || info.DiskSize != 8192 || info.DataSize != 2048 || info.UpdaterRunning {
+		t.Fatal("invalid info", info)
+	}
+	if _, err = couch.ViewInfo("missing"); err == nil {
+		t.Fatal("error nil")
+	}
+}
+
+func TestWaitForView(t *testing.T) {
+	built := make(chan struct{})
+	couch, srv := newTestCouch(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/mydb/_design/orders/_view/by_customer":
+			q := r.URL.Query()
+			if q.Get("limit") != "0" || q.Get("stale") != "" {
+				t.Error("invalid query", r.URL.RawQuery)
+			}
+			// Answered once the index is built
+			<-built
+			w.Write([]byte("{\"total_rows\":0,\"offset\":0,\"rows\":[]}"))
+		case "/mydb/_design/orders/_info":
+			// The updater hasn't started yet
+			w.Write([]byte("{\"name\":\"orders\",\"view_index\":{\"updater_running\":false}}"))
+		case "/mydb/_design/stuck/_view/by_customer":
+			<-r.Context().Done()
+		default:
+			w.WriteHeader(404)
+			w.Write([]byte("{\"error\":\"not_found\",\"reason\":\"missing\"}"))
+		}
+	})
+	defer srv.Close()
+	done := make(chan error, 1)
+	go func() { done <- couch.WaitForView(context.Background(), "orders", "by_customer") }()
+	select {
+	case err := <-done:
+		t.Fatal("returned before the index was built", err)
+	case <-time.After(20 * time.Millisecond):
+	}
+	close(built)
+	if err := <-done; err != nil {
+		t.Fatal("error not nil", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := couch.WaitForView(ctx, "stuck", "by_customer"); err != context.DeadlineExceeded {
+		t.Fatal("expected deadline exceeded", err)
+	}
+	if err := couch.WaitForView(context.Background(), "missing", "by_customer"); err == nil {
+		t.Fatal("error nil")
+	}
+}
+
+func TestViewOptions(t *testing.T) {
+	v, err := ViewOptions{}.values()
+	if err != nil {
+		t.Fatal("error not nil", err)
+	}
+	if q := v.Encode(); q != "" {
+		t.Fatal("expected empty query", q)
+	}
+	reduce := false
+	v, err = ViewOptions{
+		Key:           []interface{}{"a", 1},
+		StartKeyDocID: "doc1",
+		Limit:         10,
+		Stale:         "ok",
+		Descending:    true,
+		Reduce:        &reduce,
+		IncludeDocs:   true,
+	}.values()
+	if err != nil {
+		t.Fatal("error not nil", err)
+	}
+	q := v.Encode()
+	if q != "descending=true&include_docs=true&key=%5B%22a%22%2C1%5D&limit=10&reduce=false&stale=ok&startkey_docid=doc1" {
+		t.Fatal("invalid query", q)
+	}
+	v, err = ViewOptions{
+		Limit: 10,
+		Extra: url.Values{"limit": {"5"}, "partition": {"p1"}},
+	}.values()
+	if err != nil {
+		t.Fatal("error not nil", err)
+	}
+	if q := v.Encode(); q != "limit=5&partition=p1" {
+		t.Fatal("invalid query", q)
+	}
+	obj, err := ViewOptions{Extra: url.Values{"partition": {"p1"}, "sorted": {"false"}}}.object()
+	if err != nil {
+		t.Fatal("error not nil", err)
+	}
+	b, _ := json.Marshal(obj)
+	if string(b) != "{\"partition\":\"p1\",\"sorted\":false}" {
+		t.Fatal("invalid object", string(b))
+	}
+}
+
+func TestKeyRange(t *testing.T) {
+	k := Key{2024, 1}
+	start, end := k.Range()
+	end[0] = 2025
+	if k[0] != 2024 || len(k) != 2 {
+		t.Fatal("key modified", k)
+	}
+	end[0] = 2024
+	v, err := ViewOptions{StartKey: start, EndKey: end}.values()
+	if err != nil {
+		t.Fatal("error not nil", err)
+	}
+	if v.Get(PStartKey) != "[2024,1]" || v.Get(PEndKey) != "[2024,1,{}]" {
+		t.Fatal("invalid keys", v)
+	}
+	obj, err := ViewOptions{EndKey: Key{"a", HighKey}}.object()
+	if err != nil {
+		t.Fatal("error not nil", err)
+	}
+	if b, _ := json.Marshal(obj); string(b) != "{\"endkey\":[\"a\",{}]}" {
+		t.Fatal("invalid object", string(b))
+	}
+}
+
+func TestInRange(t *testing.T) {
+	couch, srv := newTestCouch(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/mydb/_design/events/_view/by_time" {
+			t.Error("invalid path", r.URL.Path)
+		}
+		q := r.URL.Query()
+		if q.Get("startkey") != "\"2024-01-01\"" || q.Get("endkey") != "\"2024-02-01\"" ||
+			q.Get("inclusive_end") != "false" || q.Get("include_docs") != "true" || q.Get("reduce") != "false" {
+			t.Error("invalid query", r.URL.RawQuery)
+		}
+		w.Write([]byte("{\"total_rows\":3,\"offset\":1,\"rows\":[" +
+			"{\"id\":\"e1\",\"key\":\"2024-01-03\",\"value\":null,\"doc\":{\"_id\":\"e1\",\"n\":1}}," +
+			"{\"id\":\"e2\",\"key\":\"2024-01-20\",\"value\":null,\"doc\":{\"_id\":\"e2\",\"n\":2}}]}"))
+	})
+	defer srv.Close()
+	var docs []struct {
+		Id Id `json:"_id"`
+		N  int
+	}
+	if err := couch.InRange("events", "by_time", "2024-01-01", "2024-02-01", &docs); err != nil {
+		t.Fatal("error not nil", err)
+	}
+	if len(docs) != 2 || docs[0].Id != "e1" || docs[1].N != 2 {
+		t.Fatal("invalid docs", docs)
+	}
+}
+
+func TestQueryOpts(t *testing.T) {
+	couch, srv := newTestCouch(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/mydb/_design/orders/_view/by_customer" {
+			t.Error("invalid path", r.URL.Path)
+		}
+		q := r.URL.Query()
+		if q.Get("startkey") != "\"a\"" || q.Get("endkey") != "\"b\"" || q.Get("stale") != "update_after" {
+			t.Error("invalid query", r.URL.RawQuery)
+		}
+		w.Write([]byte("{\"total_rows\":2,\"offset\":0,\"rows\":[{\"id\":\"x\",\"key\":\"a\",\"value\":1}]}"))
+	})
+	defer srv.Close()
+	result, err := couch.QueryOpts("_design/orders/_view/by_customer", nil, ViewOptions{
+		StartKey: "a",
+		EndKey:   "b",
+		Stale:    "update_after",
+	})
+	if err != nil {
+		t.Fatal("error not nil", err)
+	}
+	if result.TotalRows != 2 || len(result.Rows) != 1 || result.Rows[0].Id != "x" {
+		t.Fatal("invalid result", result)
+	}
+}
+
+func TestViewStaleFallback(t *testing.T) {
+	var stale []string
+	couch, srv := newTestCouch(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/mydb/_design/orders/_view/by_customer" {
+			t.Error("invalid path", r.URL.Path)
+		}
+		stale = append(stale, r.URL.Query().Get("stale"))
+		if r.URL.Query().Get("stale") != "ok" {
+			w.WriteHeader(500)
+			w.Write([]byte("{\"error\":\"timeout\",\"reason\":\"The request could not be processed in a reasonable amount of time.\"}"))
+			return
+		}
+		w.Write([]byte("{\"total_rows\":1,\"offset\":0,\"rows\":[{\"id\":\"x\",\"key\":\"a\",\"value\":1}]}"))
+	})
+	defer srv.Close()
+	_, err := couch.View("orders", "by_customer", ViewOptions{})
+	if e, ok := err.(*CouchError); !ok || e.StatusCode != 500 {
+		t.Fatal("expected server error", err)
+	}
+	result, err := couch.View("orders", "by_customer", ViewOptions{StaleFallback: true})
+	if err != nil {
+		t.Fatal("error not nil", err)
+	}
+	if len(result.Rows) != 1 {
+		t.Fatal("invalid result", result)
+	}
+	if len(stale) != 3 || stale[0] != "" || stale[1] != "" || stale[2] != "ok" {
+		t.Fatal("invalid requests", stale)
+	}
+}
+
+func TestAllDocsByPrefix(t *testing.T) {
+	couch, srv := newTestCouch(t, func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		if r.URL.Path != "/mydb/_all_docs" || q.Get("startkey") != "\"order:\"" || q.Get("endkey") != "\"order:\ufff0\"" ||
+			q.Get("include_docs") != "true" {
+			t.Error("invalid request", r.URL.Path, q)
+		}
+		w.Write([]byte("{\"total_rows\":5,\"offset\":1,\"rows\":[" +
+			"{\"id\":\"order:1\",\"key\":\"order:1\",\"value\":{\"rev\":\"1-a\"},\"doc\":{\"_id\":\"order:1\",\"_rev\":\"1-a\",\"total\":10}}," +
+			"{\"id\":\"order:2\",\"key\":\"order:2\",\"value\":{\"rev\":\"1-b\"},\"doc\":{\"_id\":\"order:2\",\"_rev\":\"1-b\",\"total\":20}}]}"))
+	})
+	defer srv.Close()
+	var orders []struct {
+		Document
+		Total int `json:"total"`
+	}
+	result, err := couch.AllDocsByPrefix("order:", &orders)
+	if err != nil {
+		t.Fatal("error not nil", err)
+	}
+	if len(result.Rows) != 2 || result.Rows[1].Doc == nil {
+		t.Fatal("invalid result", result)
+	}
+	if len(orders) != 2 || orders[0].Id != "order:1" || orders[0].Total != 10 || orders[1].Rev != "1-b" || orders[1].Total != 20 {
+		t.Fatal("invalid docs", orders)
+	}
+}
+
+func TestQueryMulti(t *testing.T) {
+	var running, maxRunning int32
+	couch, srv := newTestCouch(t, func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&running, 1)
+		defer atomic.AddInt32(&running, -1)
+		for {
+			m := atomic.LoadInt32(&maxRunning)
+			if n <= m || atomic.CompareAndSwapInt32(&maxRunning, m, n) {
+				break
+			}
+		}
+		switch r.URL.Path {
+		case "/mydb/_design/d/_view/slow":
+			select {
+			case <-r.Context().Done():
+			case <-time.After(time.Second):
+			}
+			return
+		case "/mydb/_design/d/_view/broken":
+			w.WriteHeader(500)
+			w.Write([]byte("{\"error\":\"unknown_error\",\"reason\":\"boom\"}"))
+			return
+		}
+		time.Sleep(5 * time.Millisecond)
+		w.Write([]byte("{\"total_rows\":1,\"offset\":0,\"rows\":[{\"id\":\"a\",\"key\":" + r.URL.Query().Get("key") + ",\"value\":null}]}"))
+	})
+	defer srv.Close()
+	couch.QueryMultiWorkers = 2
+	var queries []ViewRequest
+	for i := 0; i < 5; i++ {
+		queries = append(queries, ViewRequest{Ddoc: "d", View: "v", Options: ViewOptions{Key: i}})
+	}
+	results, err := couch.QueryMulti(context.Background(), queries)
+	if err != nil {
+		t.Fatal("error not nil", err)
+	}
+	if len(results) != 5 {
+		t.Fatal("expected 5 results", results)
+	}
+	for i, result := range results {
+		if len(result.Rows) != 1 || result.Rows[0].Key != float64(i) {
+			t.Fatal("results out of order", i, result.Rows[0])
+		}
+	}
+	if atomic.LoadInt32(&maxRunning) > 2 {
+		t.Fatal("too many concurrent queries", maxRunning)
+	}
+	start := time.Now()
+	_, err = couch.QueryMulti(context.Background(), []ViewRequest{{Ddoc: "d", View: "slow"}, {Ddoc: "d", View: "broken"}})
+	if e, ok := err.(*CouchError); !ok || e.StatusCode != 500 {
+		t.Fatal("expected couch error", err)
+	}
+	if time.Since(start) > 500*time.Millisecond {
+		t.Fatal("slow query not canceled")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err = couch.QueryMulti(ctx, []ViewRequest{{Ddoc: "d", View: "slow"}}); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatal("expected deadline exceeded", err)
+	}
+}
+
+func TestViewQueries(t *testing.T) {
+	couch, srv := newTestCouch(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" || r.URL.Path != "/mydb/_design/orders/_view/by_customer/queries" {
+			t.Error("invalid request", r.Method, r.URL.Path)
+		}
+		var v struct {
+			Queries []map[string]interface{} `json:"queries"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&v); err != nil {
+			t.Error("invalid body", err)
+		}
+		if len(v.Queries) != 2 {
+			t.Error("expected 2 queries", v.Queries)
+		}
+		q := v.Queries[0]
+		if keys, ok := q["keys"].([]interface{}); !ok || len(keys) != 2 || keys[0] != "a" || q["limit"] != float64(10) ||
+			q["include_docs"] != true || q["startkey_docid"] != "123" || q["stale"] != "ok" {
+			t.Error("invalid query", q)
+		}
+		if q = v.Queries[1]; len(q) != 2 || q["startkey"] != "b" || q["descending"] != true {
+			t.Error("invalid query", q)
+		}
+		w.Write([]byte("{\"results\":[" +
+			"{\"total_rows\":3,\"offset\":0,\"rows\":[{\"id\":\"1\",\"key\":\"a\",\"value\":1}]}," +
+			"{\"total_rows\":3,\"offset\":1,\"rows\":[{\"id\":\"2\",\"key\":\"b\",\"value\":2},{\"id\":\"3\",\"key\":\"a\",\"value\":3}]}]}"))
+	})
+	defer srv.Close()
+	results, err := couch.ViewQueries("orders", "by_customer", []ViewOptions{
+		{Keys: []interface{}{"a", "c"}, Limit: 10, IncludeDocs: true, StartKeyDocID: "123", Stale: "ok"},
+		{StartKey: "b", Descending: true},
+	})
+	if err != nil {
+		t.Fatal("error not nil", err)
+	}
+	if len(results) != 2 || len(results[0].Rows) != 1 || len(results[1].Rows) != 2 || results[1].Offset != 1 {
+		t.Fatal("invalid results", results)
+	}
+	if results[1].Rows[0].Id != "2" {
+		t.Fatal("invalid row", results[1].Rows[0])
+	}
+}